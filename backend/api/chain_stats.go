@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// ChainStatPoint aggregates the tipsets of one day or hour, base fee is in attoFIL and burnt in FIL
+type ChainStatPoint struct {
+	Time     string  `json:"time"`
+	Tipsets  int64   `json:"tipsets"`
+	Blocks   int64   `json:"blocks"`
+	Messages int64   `json:"messages"`
+	GasLimit int64   `json:"gas_limit"`
+	GasUsed  int64   `json:"gas_used"`
+	BaseFee  float64 `json:"base_fee"`
+	Burnt    float64 `json:"burnt"`
+}
+
+// chainStatFormats are the DATE_FORMAT layouts of the supported granularities
+var chainStatFormats = map[string]string{
+	"day":  "%Y-%m-%d",
+	"hour": "%Y-%m-%d %H:00",
+}
+
+// GetChainStats handles the GET /chain/stats endpoint to retrieve the base fee, gas and block statistics
+// of the chain as a daily or hourly series. The base fee is averaged over the tipsets, other values are
+// summed, and periods without any indexed tipset are left out.
+func (s *Server) GetChainStats(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", "day")
+	format, ok := chainStatFormats[granularity]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid granularity, expected day or hour"})
+		return
+	}
+
+	interval, ok := parseInterval(c.DefaultQuery("interval", "7d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []ChainStatPoint
+	if err := s.db.Model(&orm.ChainStat{}).
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(timestamp), ?) AS time,
+			COUNT(*) AS tipsets,
+			SUM(blocks) AS blocks,
+			SUM(message_count) AS messages,
+			SUM(gas_limit) AS gas_limit,
+			SUM(gas_used) AS gas_used,
+			AVG(CAST(parent_base_fee AS DECIMAL(38,0))) AS base_fee,
+			SUM(CAST(burnt AS DECIMAL(38,0))) / 1e18 AS burnt
+		`, format).
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Group("time").
+		Order("time").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []ChainStatPoint{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// parseInterval parses a positive number of days such as 7d or of hours such as 24h
+func parseInterval(param string) (time.Duration, bool) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(param, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(param, "h"):
+		unit = time.Hour
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(param[:len(param)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
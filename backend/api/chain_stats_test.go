@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		param string
+		want  time.Duration
+		ok    bool
+	}{
+		{param: "7d", want: 7 * 24 * time.Hour, ok: true},
+		{param: "24h", want: 24 * time.Hour, ok: true},
+		{param: "0d"},
+		{param: "-1h"},
+		{param: "7"},
+		{param: "d"},
+		{param: "1w"},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseInterval(tt.param)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: expected %v %v, got %v %v", tt.param, tt.want, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// FeeSamplePoint is a sample of the FIP-0100 daily fees, amounts are in FIL
+type FeeSamplePoint struct {
+	Time              string  `json:"time"`
+	Height            int64   `json:"height"`
+	DailyFee          float64 `json:"daily_fee"`
+	Miners            int64   `json:"miners"`
+	SectorDailyFee    float64 `json:"sector_daily_fee"`
+	BurntFunds        float64 `json:"burnt_funds"`
+	CirculatingSupply float64 `json:"circulating_supply"`
+}
+
+// GetFeeSamples handles the GET /fees endpoint to retrieve the samples of the daily fees charged to miners
+// since FIP-0100, with the balance of the burnt funds actor and the circulating supply at each sample
+func (s *Server) GetFeeSamples(c *gin.Context) {
+	interval, ok := parseInterval(c.DefaultQuery("interval", "30d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []FeeSamplePoint
+	if err := s.db.Model(&orm.FeeSample{}).
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(timestamp), '%Y-%m-%d %H:%i') AS time,
+			height,
+			CAST(daily_fee AS DECIMAL(38,0)) / 1e18 AS daily_fee,
+			miners,
+			CAST(sector_daily_fee AS DECIMAL(38,0)) / 1e18 AS sector_daily_fee,
+			CAST(burnt_funds AS DECIMAL(38,0)) / 1e18 AS burnt_funds,
+			CAST(circulating_supply AS DECIMAL(38,0)) / 1e18 AS circulating_supply
+		`).
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Order("height").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []FeeSamplePoint{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
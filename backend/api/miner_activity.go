@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DailyMinerActivity tells how many of the miners created in a day went on to gain power, according to the
+// samples of the power_samples handler
+type DailyMinerActivity struct {
+	Date    string `json:"date"`
+	Created int64  `json:"created"`
+	// Powered is the number of created miners that had power in any sample, Active the ones with power in
+	// the latest sample
+	Powered     int64   `json:"powered"`
+	Active      int64   `json:"active"`
+	PoweredRate float64 `json:"powered_rate"`
+	ActiveRate  float64 `json:"active_rate"`
+}
+
+// GetDailyMinerActivity handles the GET /miners/activity endpoint to retrieve, for every day, the number of
+// miners successfully created and how many of them gained power
+func (s *Server) GetDailyMinerActivity(c *gin.Context) {
+	interval, ok := parseInterval(c.DefaultQuery("interval", "30d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []DailyMinerActivity
+	if err := s.db.Table("miners AS m").
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(m.timestamp), '%Y-%m-%d') AS date,
+			COUNT(DISTINCT m.miner_id) AS created,
+			COUNT(DISTINCT powered.miner) AS powered,
+			COUNT(DISTINCT active.miner) AS active
+		`).
+		Joins(`LEFT JOIN (
+			SELECT DISTINCT miner FROM miner_powers WHERE raw_byte_power <> '0' AND deleted_at IS NULL
+		) AS powered ON powered.miner = m.miner_id`).
+		Joins(`LEFT JOIN (
+			SELECT miner FROM miner_powers WHERE raw_byte_power <> '0' AND deleted_at IS NULL
+			AND height = (SELECT MAX(height) FROM miner_powers WHERE deleted_at IS NULL)
+		) AS active ON active.miner = m.miner_id`).
+		Where("m.exit_code = 0 AND m.miner_id <> '' AND m.deleted_at IS NULL").
+		Where("m.timestamp BETWEEN ? AND ?", start, end).
+		Group("date").
+		Order("date").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []DailyMinerActivity{})
+		return
+	}
+
+	fillActivityRates(results)
+	c.JSON(http.StatusOK, results)
+}
+
+// fillActivityRates sets the share of the created miners that were powered and that are active
+func fillActivityRates(rows []DailyMinerActivity) {
+	for idx := range rows {
+		if rows[idx].Created == 0 {
+			continue
+		}
+
+		rows[idx].PoweredRate = float64(rows[idx].Powered) / float64(rows[idx].Created)
+		rows[idx].ActiveRate = float64(rows[idx].Active) / float64(rows[idx].Created)
+	}
+}
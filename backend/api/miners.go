@@ -32,6 +32,26 @@ func (s *Server) GetDailyMinerStats(c *gin.Context) {
 		}
 	}
 
+	// only successful creations are counted unless asked otherwise
+	query := s.db.Model(&orm.Miner{})
+	switch c.Query("status") {
+	case "failed":
+		query = query.Where("exit_code <> 0")
+	case "all":
+	default:
+		query = query.Where("exit_code = 0")
+	}
+
+	if sectorSize := c.Query("sector_size"); sectorSize != "" {
+		size, err := strconv.ParseUint(sectorSize, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sector_size"})
+			return
+		}
+
+		query = query.Where("sector_size = ?", size)
+	}
+
 	endTime := time.Now()
 	startTime := endTime.AddDate(0, 0, -days)
 
@@ -39,7 +59,7 @@ func (s *Server) GetDailyMinerStats(c *gin.Context) {
 	start := startTime.Unix()
 
 	var dbResults []DailyMinerStat
-	if err := s.db.Model(&orm.Miner{}).
+	if err := query.
 		Select(`
 			DATE_FORMAT(FROM_UNIXTIME(timestamp), '%Y-%m-%d') AS date, 
 			COUNT(*) AS count,
@@ -53,9 +73,21 @@ func (s *Server) GetDailyMinerStats(c *gin.Context) {
 		return
 	}
 
-	countMap := make(map[string]int64, len(dbResults))
-	costMap := make(map[string]float64, len(dbResults))
-	for _, r := range dbResults {
+	results := fillDailyMinerStats(dbResults, startTime, days)
+	if results == nil {
+		c.JSON(http.StatusOK, []DailyMinerStat{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// fillDailyMinerStats returns one stat per day from startTime over days days, taking the counts and costs of
+// rows, a day without creation reuses the first known cost
+func fillDailyMinerStats(rows []DailyMinerStat, startTime time.Time, days int) []DailyMinerStat {
+	countMap := make(map[string]int64, len(rows))
+	costMap := make(map[string]float64, len(rows))
+	for _, r := range rows {
 		countMap[r.Date] = r.Count
 		costMap[r.Date] = r.Cost
 	}
@@ -85,10 +117,5 @@ func (s *Server) GetDailyMinerStats(c *gin.Context) {
 		}
 	}
 
-	if results == nil {
-		c.JSON(http.StatusOK, []DailyMinerStat{})
-		return
-	}
-
-	c.JSON(http.StatusOK, results)
+	return results
 }
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFillDailyMinerStats(t *testing.T) {
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	rows := []DailyMinerStat{
+		{Date: "2025-04-02", Count: 3, Cost: 0.5},
+		{Date: "2025-04-04", Count: 1, Cost: 0.7},
+		// outside of the interval
+		{Date: "2025-04-10", Count: 9, Cost: 9},
+	}
+
+	stats := fillDailyMinerStats(rows, start, 3)
+	want := []DailyMinerStat{
+		{Date: "2025-04-01", Count: 0, Cost: 0.5},
+		{Date: "2025-04-02", Count: 3, Cost: 0.5},
+		{Date: "2025-04-03", Count: 0, Cost: 0.5},
+		{Date: "2025-04-04", Count: 1, Cost: 0.7},
+	}
+
+	if len(stats) != len(want) {
+		t.Fatalf("expected %d days, got %v", len(want), stats)
+	}
+	for idx := range want {
+		if stats[idx] != want[idx] {
+			t.Errorf("day %d: expected %+v, got %+v", idx, want[idx], stats[idx])
+		}
+	}
+
+	if stats := fillDailyMinerStats(nil, start, 1); len(stats) != 2 || stats[0].Count != 0 || stats[1].Cost != 0 {
+		t.Errorf("unexpected stats without creation %v", stats)
+	}
+}
+
+func TestFillActivityRates(t *testing.T) {
+	rows := []DailyMinerActivity{
+		{Date: "2025-04-01", Created: 4, Powered: 2, Active: 1},
+		{Date: "2025-04-02", Created: 0},
+	}
+
+	fillActivityRates(rows)
+
+	if rows[0].PoweredRate != 0.5 || rows[0].ActiveRate != 0.25 {
+		t.Errorf("unexpected rates %+v", rows[0])
+	}
+
+	if rows[1].PoweredRate != 0 || rows[1].ActiveRate != 0 {
+		t.Errorf("expected no rate without creation, got %+v", rows[1])
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// PledgeSamplePoint is a sample of the initial pledge and block reward, amounts are in FIL
+type PledgeSamplePoint struct {
+	Time                string  `json:"time"`
+	Height              int64   `json:"height"`
+	InitialPledge32GiB  float64 `json:"initial_pledge_32gib" gorm:"column:initial_pledge_32gib"`
+	InitialPledge64GiB  float64 `json:"initial_pledge_64gib" gorm:"column:initial_pledge_64gib"`
+	CirculatingSupply   float64 `json:"circulating_supply"`
+	EpochReward         float64 `json:"epoch_reward"`
+	EpochRewardEstimate float64 `json:"epoch_reward_estimate"`
+	SectorDailyReward   float64 `json:"sector_daily_reward"`
+}
+
+// DailyMessageTerminationStat sums the termination fees paid by TerminateSectors messages in a day
+type DailyMessageTerminationStat struct {
+	Date            string  `json:"date"`
+	Terminations    int64   `json:"terminations"`
+	Miners          int64   `json:"miners"`
+	DeclaredSectors int64   `json:"declared_sectors"`
+	Fee             float64 `json:"fee"`
+}
+
+// GetPledgeSamples handles the GET /pledges endpoint to retrieve the samples of the initial pledge of new
+// sectors, the circulating supply and the reward estimates
+func (s *Server) GetPledgeSamples(c *gin.Context) {
+	interval, ok := parseInterval(c.DefaultQuery("interval", "30d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []PledgeSamplePoint
+	if err := s.db.Model(&orm.PledgeSample{}).
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(timestamp), '%Y-%m-%d %H:%i') AS time,
+			height,
+			CAST(initial_pledge_32gib AS DECIMAL(38,0)) / 1e18 AS initial_pledge_32gib,
+			CAST(initial_pledge_64gib AS DECIMAL(38,0)) / 1e18 AS initial_pledge_64gib,
+			CAST(circulating_supply AS DECIMAL(38,0)) / 1e18 AS circulating_supply,
+			CAST(epoch_reward AS DECIMAL(38,0)) / 1e18 AS epoch_reward,
+			CAST(epoch_reward_estimate AS DECIMAL(38,0)) / 1e18 AS epoch_reward_estimate,
+			CAST(sector_daily_reward AS DECIMAL(38,0)) / 1e18 AS sector_daily_reward
+		`).
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Order("height").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []PledgeSamplePoint{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GetDailyMessageTerminationStats handles the GET /terminations/messages endpoint to retrieve the daily
+// number of TerminateSectors messages that paid a fee, the miners involved, the sectors they declared and the
+// fees paid
+func (s *Server) GetDailyMessageTerminationStats(c *gin.Context) {
+	interval, ok := parseInterval(c.DefaultQuery("interval", "30d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []DailyMessageTerminationStat
+	if err := s.db.Model(&orm.MessageTermination{}).
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(timestamp), '%Y-%m-%d') AS date,
+			COUNT(*) AS terminations,
+			COUNT(DISTINCT miner) AS miners,
+			SUM(declared_sectors) AS declared_sectors,
+			SUM(CAST(fee AS DECIMAL(38,0))) / 1e18 AS fee
+		`).
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Group("date").
+		Order("date").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []DailyMessageTerminationStat{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
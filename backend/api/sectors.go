@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// DailySectorStat counts the sector messages of one method sent in a day
+type DailySectorStat struct {
+	Date     string `json:"date"`
+	Method   string `json:"method"`
+	Messages int64  `json:"messages"`
+	Sectors  int64  `json:"sectors"`
+	GasUsed  int64  `json:"gas_used"`
+}
+
+// GetDailySectorStats handles the GET /sectors endpoint to retrieve the daily number of sector onboarding and
+// maintenance messages by method, with the sectors they cover and the gas they used
+func (s *Server) GetDailySectorStats(c *gin.Context) {
+	interval, ok := parseInterval(c.DefaultQuery("interval", "7d"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval, expected a number of days (7d) or hours (24h)"})
+		return
+	}
+
+	// only successful messages are counted unless asked otherwise
+	query := s.db.Model(&orm.SectorMessage{})
+	switch c.Query("status") {
+	case "failed":
+		query = query.Where("exit_code <> 0")
+	case "all":
+	default:
+		query = query.Where("exit_code = 0")
+	}
+
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method_name = ?", method)
+	}
+
+	end := time.Now().Unix()
+	start := end - int64(interval.Seconds())
+
+	var results []DailySectorStat
+	if err := query.
+		Select(`
+			DATE_FORMAT(FROM_UNIXTIME(timestamp), '%Y-%m-%d') AS date,
+			method_name AS method,
+			COUNT(*) AS messages,
+			SUM(sector_count) AS sectors,
+			SUM(gas_used) AS gas_used
+		`).
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Group("date, method_name").
+		Order("date, method_name").
+		Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if results == nil {
+		c.JSON(http.StatusOK, []DailySectorStat{})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -26,6 +26,12 @@ func NewServer(db *gorm.DB) *Server {
 // registerRouter registers the API routes
 func (s *Server) registerRouter() {
 	s.engine.GET("/miners", s.GetDailyMinerStats)
+	s.engine.GET("/miners/activity", s.GetDailyMinerActivity)
+	s.engine.GET("/chain/stats", s.GetChainStats)
+	s.engine.GET("/sectors", s.GetDailySectorStats)
+	s.engine.GET("/fees", s.GetFeeSamples)
+	s.engine.GET("/pledges", s.GetPledgeSamples)
+	s.engine.GET("/terminations/messages", s.GetDailyMessageTerminationStats)
 }
 
 // Run starts the server on the specified port
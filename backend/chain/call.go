@@ -0,0 +1,78 @@
+package chain
+
+import (
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+)
+
+// Call is an actor method invocation, either a message sent on chain (direct) or a call made by an
+// actor while executing such a message (internal)
+type Call struct {
+	// MsgCid is the cid of the on-chain message whose execution made this call
+	MsgCid cid.Cid
+	// Index is the position of the call in the execution trace of the message, 0 for the message itself
+	Index int
+	// Depth is the number of calls between the message and this call, 0 for the message itself
+	Depth    int
+	Internal bool
+	Parent   *Call
+
+	From     address.Address
+	To       address.Address
+	Method   abi.MethodNum
+	Params   []byte
+	Value    abi.TokenAmount
+	ExitCode exitcode.ExitCode
+	Return   []byte
+}
+
+// CallHandler defines the function type for handling calls during block synchronization
+type CallHandler func(blockMeta *BlockMeta, call *Call) error
+
+// directCall builds the call of an executed message from the message and its receipt
+func directCall(msgCid cid.Cid, msg *types.Message, receipt *types.MessageReceipt) *Call {
+	return &Call{
+		MsgCid:   msgCid,
+		From:     msg.From,
+		To:       msg.To,
+		Method:   msg.Method,
+		Params:   msg.Params,
+		Value:    msg.Value,
+		ExitCode: receipt.ExitCode,
+		Return:   receipt.Return,
+	}
+}
+
+// traceCalls flattens the execution trace of a message into calls in execution order
+func traceCalls(msgCid cid.Cid, trace *types.ExecutionTrace) []*Call {
+	var calls []*Call
+
+	var walk func(trace *types.ExecutionTrace, parent *Call, depth int)
+	walk = func(trace *types.ExecutionTrace, parent *Call, depth int) {
+		call := &Call{
+			MsgCid:   msgCid,
+			Index:    len(calls),
+			Depth:    depth,
+			Internal: depth > 0,
+			Parent:   parent,
+			From:     trace.Msg.From,
+			To:       trace.Msg.To,
+			Method:   trace.Msg.Method,
+			Params:   trace.Msg.Params,
+			Value:    trace.Msg.Value,
+			ExitCode: trace.MsgRct.ExitCode,
+			Return:   trace.MsgRct.Return,
+		}
+		calls = append(calls, call)
+
+		for idx := range trace.Subcalls {
+			walk(&trace.Subcalls[idx], call, depth+1)
+		}
+	}
+	walk(trace, nil, 0)
+
+	return calls
+}
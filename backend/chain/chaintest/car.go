@@ -0,0 +1,184 @@
+package chaintest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	amt "github.com/filecoin-project/go-amt-ipld/v2"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// WriteCAR writes the chain from its genesis to the head to w as an FRC-0108 snapshot, with a metadata block
+// as root. Headers are rebuilt to link the real messages and receipts, so blocks in the file have other cids
+// than the ones served by Chain, everything else is the same.
+func (c *Chain) WriteCAR(w io.Writer) error {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	ctx := context.Background()
+	bs := &memBlockstore{blocks: make(map[cid.Cid][]byte)}
+	store := cbor.NewCborStore(bs)
+
+	var tipsets []*types.TipSet
+	for ts := c.head; ; {
+		tipsets = append(tipsets, ts)
+		if ts.Parents().IsEmpty() {
+			break
+		}
+
+		parent, err := c.lookup(ts.Parents())
+		if err != nil {
+			return err
+		}
+		ts = parent
+	}
+	slices.Reverse(tipsets)
+
+	var parentCids []cid.Cid
+	var parent *types.TipSet
+	for _, ts := range tipsets {
+		var receipts []cbg.CBORMarshaler
+		if parent != nil {
+			for _, m := range c.executed(parent) {
+				receipts = append(receipts, c.receipt(m))
+			}
+		}
+
+		receiptsRoot, err := amt.FromArray(ctx, store, receipts)
+		if err != nil {
+			return err
+		}
+
+		var cids []cid.Cid
+		for _, blk := range ts.Blocks() {
+			msgs := c.blocks[blk.Cid()].msgs
+			messagesRoot, err := putMessages(ctx, store, msgs)
+			if err != nil {
+				return err
+			}
+
+			header := *blk
+			header.Parents = parentCids
+			header.ParentMessageReceipts = receiptsRoot
+			header.Messages = messagesRoot
+
+			bcid, err := store.Put(ctx, &header)
+			if err != nil {
+				return err
+			}
+			cids = append(cids, bcid)
+		}
+
+		// headers keep their ticket, so the rebuilt tipset has its blocks in the same order
+		parentCids, parent = cids, ts
+	}
+
+	// metadata block: [version, head tipset key, f3 data]
+	var meta bytes.Buffer
+	cw := cbg.NewCborWriter(&meta)
+	if err := cw.WriteMajorTypeHeader(cbg.MajArray, 3); err != nil {
+		return err
+	}
+	if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, 2); err != nil {
+		return err
+	}
+	if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(parentCids))); err != nil {
+		return err
+	}
+	for _, bcid := range parentCids {
+		if err := cbg.WriteCid(cw, bcid); err != nil {
+			return err
+		}
+	}
+	if _, err := cw.Write(cbg.CborNull); err != nil {
+		return err
+	}
+
+	root, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: cbor.DefaultMultihash, MhLength: -1}.Sum(meta.Bytes())
+	if err != nil {
+		return err
+	}
+	bs.put(root, meta.Bytes())
+
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w); err != nil {
+		return err
+	}
+
+	for _, bcid := range bs.order {
+		if err := util.LdWrite(w, bcid.Bytes(), bs.blocks[bcid]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putMessages stores the messages of a block and returns the cid of their types.MessageRoot
+func putMessages(ctx context.Context, store cbor.IpldStore, msgs *types.BlockMessages) (cid.Cid, error) {
+	var blsCids, secpkCids []cbg.CBORMarshaler
+	for _, m := range msgs.BlsMessages {
+		mcid, err := store.Put(ctx, m)
+		if err != nil {
+			return cid.Undef, err
+		}
+		blsCids = append(blsCids, (*cbg.CborCid)(&mcid))
+	}
+
+	for _, sm := range msgs.SecpkMessages {
+		mcid, err := store.Put(ctx, sm)
+		if err != nil {
+			return cid.Undef, err
+		}
+		secpkCids = append(secpkCids, (*cbg.CborCid)(&mcid))
+	}
+
+	blsRoot, err := amt.FromArray(ctx, store, blsCids)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	secpkRoot, err := amt.FromArray(ctx, store, secpkCids)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	return store.Put(ctx, &types.MessageRoot{BlsRoot: blsRoot, SecpkRoot: secpkRoot})
+}
+
+// memBlockstore keeps blocks in memory in the order they were first put
+type memBlockstore struct {
+	blocks map[cid.Cid][]byte
+	order  []cid.Cid
+}
+
+func (m *memBlockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	data, ok := m.blocks[c]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", c)
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (m *memBlockstore) Put(_ context.Context, blk blocks.Block) error {
+	m.put(blk.Cid(), blk.RawData())
+	return nil
+}
+
+func (m *memBlockstore) put(c cid.Cid, data []byte) {
+	if _, ok := m.blocks[c]; ok {
+		return
+	}
+
+	m.blocks[c] = data
+	m.order = append(m.order, c)
+}
@@ -0,0 +1,681 @@
+// Package chaintest provides an in-memory Filecoin chain for testing chain synchronization without a node.
+package chaintest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// GenesisTimestamp is the timestamp of epoch 0 of every chain built by this package
+const GenesisTimestamp = 1598306400
+
+// blockDelaySecs is the interval between two epochs
+const blockDelaySecs = 30
+
+type blockEntry struct {
+	tipset *types.TipSet
+	msgs   *types.BlockMessages
+}
+
+// Chain is an in-memory chain, it implements the node API methods used by chain.ChainSource.
+// Tipsets are appended to the head with Add and AddTipSet, SetHead moves the head to build forks.
+type Chain struct {
+	lk sync.RWMutex
+
+	head    *types.TipSet
+	nulls   int64
+	seq     int
+	tipsets map[string]*types.TipSet
+	// ancestors holds for every tipset its ancestors 1, 2, 4, ... tipsets back, so that looking up a height
+	// takes a logarithmic number of steps
+	ancestors map[string][]*types.TipSet
+	blocks    map[cid.Cid]*blockEntry
+	receipts  map[cid.Cid]*types.MessageReceipt
+	subcalls  map[cid.Cid][]types.ExecutionTrace
+	events    map[cid.Cid][]types.Event
+	actors    map[address.Address]*types.Actor
+
+	deadlines map[address.Address][]types.Deadline
+	supply    types.CirculatingSupply
+	pledges   map[abi.SectorSize]abi.TokenAmount
+	powers    map[address.Address]*types.MinerPower
+	objects   map[cid.Cid][]byte
+
+	f3Running   bool
+	f3Finalized int64
+
+	subscribers []chan []*types.HeadChange
+}
+
+// NewChain creates a chain whose genesis tipset is at height
+func NewChain(height int64) *Chain {
+	c := &Chain{
+		tipsets:   make(map[string]*types.TipSet),
+		ancestors: make(map[string][]*types.TipSet),
+		blocks:    make(map[cid.Cid]*blockEntry),
+		receipts:  make(map[cid.Cid]*types.MessageReceipt),
+		subcalls:  make(map[cid.Cid][]types.ExecutionTrace),
+		events:    make(map[cid.Cid][]types.Event),
+		actors:    make(map[address.Address]*types.Actor),
+
+		deadlines: make(map[address.Address][]types.Deadline),
+		pledges:   make(map[abi.SectorSize]abi.TokenAmount),
+		powers:    make(map[address.Address]*types.MinerPower),
+		objects:   make(map[cid.Cid][]byte),
+	}
+	c.head = c.newTipSet(abi.ChainEpoch(height), types.EmptyTSK, &types.BlockMessages{})
+
+	return c
+}
+
+// Add appends a tipset made of a single block with the given BLS messages
+func (c *Chain) Add(msgs ...*types.Message) *types.TipSet {
+	return c.AddTipSet(&types.BlockMessages{BlsMessages: msgs})
+}
+
+// AddTipSet appends a tipset with one block per entry of blocks
+func (c *Chain) AddTipSet(blocks ...*types.BlockMessages) *types.TipSet {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	height := c.head.Height() + 1 + abi.ChainEpoch(c.nulls)
+	c.nulls = 0
+	c.head = c.newTipSet(height, c.head.Key(), blocks...)
+	c.notify(&types.HeadChange{Type: types.HCApply, Val: c.head})
+
+	return c.head
+}
+
+// NullRounds skips the next n epochs, the next added tipset is built n epochs later
+func (c *Chain) NullRounds(n int64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.nulls += n
+}
+
+// SetHead moves the head of the chain to ts, tipsets added afterwards build a fork on top of it
+func (c *Chain) SetHead(ts *types.TipSet) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.notify(&types.HeadChange{Type: types.HCRevert, Val: c.head}, &types.HeadChange{Type: types.HCApply, Val: ts})
+	c.head = ts
+	c.nulls = 0
+}
+
+// CloseNotify closes all the channels returned by ChainNotify, as a node does when the connection drops
+func (c *Chain) CloseNotify() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	for _, sub := range c.subscribers {
+		close(sub)
+	}
+	c.subscribers = nil
+}
+
+// notify sends changes to all subscribers without blocking, it must be called with the lock held
+func (c *Chain) notify(changes ...*types.HeadChange) {
+	for _, sub := range c.subscribers {
+		select {
+		case sub <- changes:
+		default:
+		}
+	}
+}
+
+// SetReceipt overrides the receipt of a message, by default a message succeeds using all its gas
+func (c *Chain) SetReceipt(msg cid.Cid, receipt *types.MessageReceipt) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.receipts[msg] = receipt
+}
+
+// SetSubcalls sets the internal calls made while executing a message, they are returned by StateCompute
+func (c *Chain) SetSubcalls(msg cid.Cid, subcalls ...types.ExecutionTrace) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.subcalls[msg] = subcalls
+}
+
+// SetEvents sets the actor events emitted while executing a message, they are returned by GetActorEventsRaw
+func (c *Chain) SetEvents(msg cid.Cid, events ...types.Event) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.events[msg] = events
+}
+
+// SetActor sets the actor returned by StateGetActor for addr
+func (c *Chain) SetActor(addr address.Address, actor *types.Actor) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.actors[addr] = actor
+}
+
+// SetMinerDeadlines sets the deadlines returned by StateMinerDeadlines for the miner maddr, the miners
+// with deadlines are the ones listed by StateListMiners
+func (c *Chain) SetMinerDeadlines(maddr address.Address, deadlines ...types.Deadline) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.deadlines[maddr] = deadlines
+}
+
+// SetCirculatingSupply sets the supply returned by StateVMCirculatingSupplyInternal
+func (c *Chain) SetCirculatingSupply(supply types.CirculatingSupply) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.supply = supply
+}
+
+// SetMinerPower sets the power returned by StateMinerPower for the miner maddr
+func (c *Chain) SetMinerPower(maddr address.Address, power *types.MinerPower) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.powers[maddr] = power
+}
+
+// SetInitialPledge sets the pledge returned by StateMinerInitialPledgeForSector for sectors of size
+func (c *Chain) SetInitialPledge(size abi.SectorSize, pledge abi.TokenAmount) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.pledges[size] = pledge
+}
+
+// PutObject stores the CBOR encoding of obj, to be read with ChainReadObj, and returns its cid. It is used
+// for the head of the actors set with SetActor.
+func (c *Chain) PutObject(obj cbg.CBORMarshaler) cid.Cid {
+	var buf bytes.Buffer
+	if err := obj.MarshalCBOR(&buf); err != nil {
+		panic(err)
+	}
+
+	ocid, err := abi.CidBuilder.Sum(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.objects[ocid] = buf.Bytes()
+	return ocid
+}
+
+// SetF3Finalized marks F3 as running with the tipset at height as the latest finalized one
+func (c *Chain) SetF3Finalized(height int64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.f3Running = true
+	c.f3Finalized = height
+}
+
+// newTipSet builds and stores a tipset, it must be called with the lock held
+func (c *Chain) newTipSet(height abi.ChainEpoch, parents types.TipSetKey, blocks ...*types.BlockMessages) *types.TipSet {
+	if len(blocks) == 0 {
+		blocks = []*types.BlockMessages{{}}
+	}
+
+	headers := make([]*types.BlockHeader, 0, len(blocks))
+	byHeader := make(map[*types.BlockHeader]*types.BlockMessages, len(blocks))
+	for _, msgs := range blocks {
+		c.seq++
+		miner, _ := address.NewIDAddress(uint64(1000 + c.seq))
+		header := &types.BlockHeader{
+			Miner:                 miner,
+			Ticket:                &types.Ticket{VRFProof: []byte(fmt.Sprintf("ticket-%d", c.seq))},
+			ElectionProof:         &types.ElectionProof{WinCount: 1, VRFProof: []byte(fmt.Sprintf("election-%d", c.seq))},
+			Parents:               parents.Cids(),
+			ParentWeight:          big.NewInt(int64(height)),
+			Height:                height,
+			ParentStateRoot:       dummyCid("state"),
+			ParentMessageReceipts: dummyCid("receipts"),
+			Messages:              dummyCid(fmt.Sprintf("messages-%d", c.seq)),
+			BLSAggregate:          &crypto.Signature{Type: crypto.SigTypeBLS},
+			Timestamp:             GenesisTimestamp + uint64(height)*blockDelaySecs,
+			BlockSig:              &crypto.Signature{Type: crypto.SigTypeSecp256k1},
+			ParentBaseFee:         big.NewInt(100),
+		}
+		headers = append(headers, header)
+		byHeader[header] = msgs
+	}
+
+	ts, err := types.NewTipSet(headers)
+	if err != nil {
+		panic(err)
+	}
+
+	c.tipsets[ts.Key().String()] = ts
+	if parent, ok := c.tipsets[parents.String()]; ok && !parents.IsEmpty() {
+		ancestors := []*types.TipSet{parent}
+		for k := 0; ; k++ {
+			next := c.ancestors[ancestors[k].Key().String()]
+			if k >= len(next) {
+				break
+			}
+			ancestors = append(ancestors, next[k])
+		}
+		c.ancestors[ts.Key().String()] = ancestors
+	}
+	for _, header := range ts.Blocks() {
+		msgs := byHeader[header]
+		cids := make([]cid.Cid, 0, len(msgs.BlsMessages)+len(msgs.SecpkMessages))
+		for _, m := range msgs.BlsMessages {
+			cids = append(cids, m.Cid())
+		}
+		for _, sm := range msgs.SecpkMessages {
+			cids = append(cids, sm.Cid())
+		}
+
+		c.blocks[header.Cid()] = &blockEntry{
+			tipset: ts,
+			msgs: &types.BlockMessages{
+				BlsMessages:   msgs.BlsMessages,
+				SecpkMessages: msgs.SecpkMessages,
+				Cids:          cids,
+			},
+		}
+	}
+
+	return ts
+}
+
+// lookup resolves tsk to a tipset, an empty key resolves to the head
+func (c *Chain) lookup(tsk types.TipSetKey) (*types.TipSet, error) {
+	if tsk.IsEmpty() {
+		return c.head, nil
+	}
+
+	ts, ok := c.tipsets[tsk.String()]
+	if !ok {
+		return nil, fmt.Errorf("tipset %s not found", tsk)
+	}
+
+	return ts, nil
+}
+
+// executed returns the messages of ts in execution order without duplicates
+func (c *Chain) executed(ts *types.TipSet) []types.MessageCID {
+	var out []types.MessageCID
+	seen := make(map[cid.Cid]struct{})
+	for _, blk := range ts.Blocks() {
+		msgs := c.blocks[blk.Cid()].msgs
+		add := func(mcid cid.Cid, m *types.Message) {
+			if _, ok := seen[mcid]; ok {
+				return
+			}
+
+			seen[mcid] = struct{}{}
+			out = append(out, types.MessageCID{Cid: mcid, Message: m})
+		}
+
+		for _, m := range msgs.BlsMessages {
+			add(m.Cid(), m)
+		}
+		for _, sm := range msgs.SecpkMessages {
+			add(sm.Cid(), &sm.Message)
+		}
+	}
+
+	return out
+}
+
+// parentOf returns the parent tipset of the tipset containing the block bcid
+func (c *Chain) parentOf(bcid cid.Cid) (*types.TipSet, error) {
+	entry, ok := c.blocks[bcid]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", bcid)
+	}
+
+	return c.lookup(entry.tipset.Parents())
+}
+
+// ChainHead returns the head of the chain
+func (c *Chain) ChainHead(_ context.Context) (*types.TipSet, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	return c.head, nil
+}
+
+// ChainNotify returns a channel which first receives the current head, then the changes made by AddTipSet and
+// SetHead until the chain is closed with CloseNotify
+func (c *Chain) ChainNotify(_ context.Context) (<-chan []*types.HeadChange, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	sub := make(chan []*types.HeadChange, 16)
+	sub <- []*types.HeadChange{{Type: types.HCCurrent, Val: c.head}}
+	c.subscribers = append(c.subscribers, sub)
+
+	return sub, nil
+}
+
+// earliestFrom returns the earliest tipset on the chain of ts whose height is at least height
+func (c *Chain) earliestFrom(ts *types.TipSet, height abi.ChainEpoch) *types.TipSet {
+	for k := len(c.ancestors[ts.Key().String()]) - 1; k >= 0; k-- {
+		if ancestors := c.ancestors[ts.Key().String()]; k < len(ancestors) && ancestors[k].Height() >= height {
+			ts = ancestors[k]
+		}
+	}
+
+	return ts
+}
+
+// ChainGetTipSetByHeight returns the tipset at height on the chain of tsk, or the previous non-null
+// tipset if height is a null round
+func (c *Chain) ChainGetTipSetByHeight(_ context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	ts, err := c.lookup(tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	if height > ts.Height() {
+		return nil, fmt.Errorf("looking for tipset with height greater than start point")
+	}
+
+	if ts = c.earliestFrom(ts, height); ts.Height() == height {
+		return ts, nil
+	}
+
+	ancestors := c.ancestors[ts.Key().String()]
+	if len(ancestors) == 0 {
+		return nil, fmt.Errorf("no tipset at height %d", height)
+	}
+
+	return ancestors[0], nil
+}
+
+// ChainGetTipSetAfterHeight returns the tipset at height on the chain of tsk, or the next non-null
+// tipset if height is a null round
+func (c *Chain) ChainGetTipSetAfterHeight(_ context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	ts, err := c.lookup(tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	if height > ts.Height() {
+		return nil, fmt.Errorf("looking for tipset with height greater than start point")
+	}
+
+	return c.earliestFrom(ts, height), nil
+}
+
+// ChainGetBlockMessages returns the messages included in the block bcid
+func (c *Chain) ChainGetBlockMessages(_ context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	entry, ok := c.blocks[bcid]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", bcid)
+	}
+
+	return entry.msgs, nil
+}
+
+// ChainGetParentMessages returns the messages executed in the parent tipset of the block bcid
+func (c *Chain) ChainGetParentMessages(_ context.Context, bcid cid.Cid) ([]types.MessageCID, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	parent, err := c.parentOf(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.executed(parent), nil
+}
+
+// ChainGetParentReceipts returns the receipts of the messages executed in the parent tipset of the block bcid
+func (c *Chain) ChainGetParentReceipts(_ context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	parent, err := c.parentOf(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := c.executed(parent)
+	receipts := make([]*types.MessageReceipt, 0, len(msgs))
+	for _, m := range msgs {
+		receipts = append(receipts, c.receipt(m))
+	}
+
+	return receipts, nil
+}
+
+// receipt returns the receipt of an executed message, it must be called with the lock held
+func (c *Chain) receipt(m types.MessageCID) *types.MessageReceipt {
+	if receipt, ok := c.receipts[m.Cid]; ok {
+		return receipt
+	}
+
+	return &types.MessageReceipt{GasUsed: m.Message.GasLimit}
+}
+
+// StateCompute returns the execution traces of the messages of the tipset tsk, built from their receipts
+// and the internal calls set with SetSubcalls
+func (c *Chain) StateCompute(_ context.Context, _ abi.ChainEpoch, _ []*types.Message, tsk types.TipSetKey) (*types.ComputeStateOutput, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	ts, err := c.lookup(tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &types.ComputeStateOutput{Root: dummyCid("state")}
+	for _, m := range c.executed(ts) {
+		receipt := c.receipt(m)
+		out.Trace = append(out.Trace, &types.InvocResult{
+			MsgCid: m.Cid,
+			Msg:    m.Message,
+			MsgRct: receipt,
+			ExecutionTrace: types.ExecutionTrace{
+				Msg: types.MessageTrace{
+					From:   m.Message.From,
+					To:     m.Message.To,
+					Value:  m.Message.Value,
+					Method: m.Message.Method,
+					Params: m.Message.Params,
+				},
+				MsgRct: types.ReturnTrace{
+					ExitCode: receipt.ExitCode,
+					Return:   receipt.Return,
+				},
+				Subcalls: c.subcalls[m.Cid],
+			},
+		})
+	}
+
+	return out, nil
+}
+
+// GetActorEventsRaw returns the events set with SetEvents for the messages of the tipset of the filter,
+// in execution order. Only queries by tipset are supported, and only the addresses of the filter are applied.
+func (c *Chain) GetActorEventsRaw(_ context.Context, filter *types.ActorEventFilter) ([]*types.ActorEvent, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	if filter == nil || filter.TipSetKey == nil {
+		return nil, fmt.Errorf("only events of a tipset can be queried")
+	}
+
+	ts, err := c.lookup(*filter.TipSetKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*types.ActorEvent
+	for _, m := range c.executed(ts) {
+		for _, event := range c.events[m.Cid] {
+			emitter, err := address.NewIDAddress(uint64(event.Emitter))
+			if err != nil {
+				return nil, err
+			}
+
+			if len(filter.Addresses) > 0 && !slices.Contains(filter.Addresses, emitter) {
+				continue
+			}
+
+			out = append(out, &types.ActorEvent{
+				Entries:   event.Entries,
+				Emitter:   emitter,
+				Height:    ts.Height(),
+				TipSetKey: ts.Key(),
+				MsgCid:    m.Cid,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// StateGetActor returns the actor set with SetActor
+func (c *Chain) StateGetActor(_ context.Context, addr address.Address, _ types.TipSetKey) (*types.Actor, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	actor, ok := c.actors[addr]
+	if !ok {
+		return nil, types.ErrActorNotFound
+	}
+
+	return actor, nil
+}
+
+// StateListMiners returns the miners set with SetMinerDeadlines, sorted
+func (c *Chain) StateListMiners(_ context.Context, _ types.TipSetKey) ([]address.Address, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	miners := make([]address.Address, 0, len(c.deadlines))
+	for maddr := range c.deadlines {
+		miners = append(miners, maddr)
+	}
+	slices.SortFunc(miners, func(a, b address.Address) int { return strings.Compare(a.String(), b.String()) })
+
+	return miners, nil
+}
+
+// StateMinerDeadlines returns the deadlines set with SetMinerDeadlines
+func (c *Chain) StateMinerDeadlines(_ context.Context, maddr address.Address, _ types.TipSetKey) ([]types.Deadline, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	deadlines, ok := c.deadlines[maddr]
+	if !ok {
+		return nil, types.ErrActorNotFound
+	}
+
+	return deadlines, nil
+}
+
+// StateVMCirculatingSupplyInternal returns the supply set with SetCirculatingSupply
+func (c *Chain) StateVMCirculatingSupplyInternal(_ context.Context, _ types.TipSetKey) (types.CirculatingSupply, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	return c.supply, nil
+}
+
+// StateMinerPower returns the power set with SetMinerPower
+func (c *Chain) StateMinerPower(_ context.Context, maddr address.Address, _ types.TipSetKey) (*types.MinerPower, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	power, ok := c.powers[maddr]
+	if !ok {
+		return nil, types.ErrActorNotFound
+	}
+
+	return power, nil
+}
+
+// StateMinerInitialPledgeForSector returns the pledge set with SetInitialPledge for sectors of sectorSize
+func (c *Chain) StateMinerInitialPledgeForSector(_ context.Context, _ abi.ChainEpoch, sectorSize abi.SectorSize, _ uint64, _ types.TipSetKey) (types.BigInt, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	pledge, ok := c.pledges[sectorSize]
+	if !ok {
+		return types.EmptyInt, fmt.Errorf("no initial pledge for %d bytes sectors", sectorSize)
+	}
+
+	return pledge, nil
+}
+
+// ChainReadObj returns an object stored with PutObject
+func (c *Chain) ChainReadObj(_ context.Context, ocid cid.Cid) ([]byte, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	data, ok := c.objects[ocid]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", ocid)
+	}
+
+	return data, nil
+}
+
+// F3IsRunning reports whether SetF3Finalized has been called
+func (c *Chain) F3IsRunning(_ context.Context) (bool, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	return c.f3Running, nil
+}
+
+// F3GetLatestCertificate returns a certificate finalizing the tipset set with SetF3Finalized
+func (c *Chain) F3GetLatestCertificate(_ context.Context) (*certs.FinalityCertificate, error) {
+	c.lk.RLock()
+	defer c.lk.RUnlock()
+
+	if !c.f3Running {
+		return nil, fmt.Errorf("f3 is not running")
+	}
+
+	return &certs.FinalityCertificate{
+		ECChain: &gpbft.ECChain{TipSets: []*gpbft.TipSet{{Epoch: c.f3Finalized}}},
+	}, nil
+}
+
+func dummyCid(s string) cid.Cid {
+	c, err := abi.CidBuilder.Sum([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
@@ -0,0 +1,75 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+// IsActorNotFound reports whether err tells that there is no actor at the requested address, in which case
+// there is nothing to retry
+func IsActorNotFound(err error) bool {
+	return err != nil && (errors.Is(err, types.ErrActorNotFound) || strings.Contains(strings.ToLower(err.Error()), "actor not found"))
+}
+
+// transientMessages are fragments of error messages returned by the RPC client for failures which are
+// not tied to the request itself
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"connection closed",
+	"broken pipe",
+	"no route to host",
+	"network is unreachable",
+	"timeout",
+	"unexpected eof",
+	"websocket",
+	"do request error",
+	"http status 5",
+	"http status 429",
+	"too many requests",
+	"bad gateway",
+	"service unavailable",
+}
+
+// isTransient reports whether err is likely to go away when the call is retried, possibly on another node.
+// Any other error, such as a missing block or an invalid request, is permanent.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	var connErr *jsonrpc.RPCConnectionError
+	if errors.As(err, &netErr) || errors.As(err, &connErr) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range transientMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package chain
+
+import (
+	"bytes"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// topicKeys are the entry keys of the topics of an EVM log, in order
+var topicKeys = []string{"t1", "t2", "t3", "t4"}
+
+// Event is an actor event emitted while executing a message, either a log of an EVM contract, made of
+// topics and data, or an event of a built-in actor, made of a $type and CBOR fields
+type Event struct {
+	// MsgCid is the cid of the message whose execution emitted the event
+	MsgCid cid.Cid
+	// Index is the position of the event among the events emitted by the message
+	Index int
+	// Emitter is the actor that emitted the event, an f4 address for contracts that have one
+	Emitter address.Address
+	Entries []types.EventEntry
+}
+
+// EventHandler defines the function type for handling actor events during block synchronization. blockMeta
+// is the block that included the message, the events of implicit messages such as cron are delivered after
+// the messages of the epoch with an undefined block cid.
+type EventHandler func(blockMeta *BlockMeta, event *Event) error
+
+// Topics returns the topics of an EVM log in order, the first one is the hash of the event signature
+func (e *Event) Topics() [][]byte {
+	var topics [][]byte
+	for _, key := range topicKeys {
+		value, ok := e.entry(key)
+		if !ok {
+			break
+		}
+		topics = append(topics, value)
+	}
+
+	return topics
+}
+
+// Data returns the data of an EVM log
+func (e *Event) Data() []byte {
+	data, _ := e.entry("d")
+	return data
+}
+
+// Type returns the type of a built-in actor event, such as sector-activated, or an empty string for a log
+func (e *Event) Type() string {
+	value, ok := e.entry("$type")
+	if !ok {
+		return ""
+	}
+
+	typ, err := cbg.ReadString(bytes.NewReader(value))
+	if err != nil {
+		return ""
+	}
+
+	return typ
+}
+
+func (e *Event) entry(key string) ([]byte, bool) {
+	for _, entry := range e.Entries {
+		if entry.Key == key {
+			return entry.Value, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,82 @@
+package chain
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+// the gas limit of a message may exceed the gas it used by 10% before the excess is burned
+const (
+	gasOveruseNum   = 11
+	gasOveruseDenom = 10
+)
+
+// GasOutputs splits the gas fee a message paid, amounts are in attoFIL
+type GasOutputs struct {
+	// BaseFeeBurn is the base fee paid for the gas used, it is burned
+	BaseFeeBurn abi.TokenAmount
+	// OverEstimationBurn is the base fee paid for the part of the gas limit that was over-estimated, it is
+	// burned
+	OverEstimationBurn abi.TokenAmount
+	// MinerPenalty is charged to the block miner when the fee cap of the message is below the base fee, it is
+	// burned
+	MinerPenalty abi.TokenAmount
+	// MinerTip is the premium paid to the block miner
+	MinerTip abi.TokenAmount
+}
+
+// Burned returns the total amount burned, including the penalty of the block miner
+func (o GasOutputs) Burned() abi.TokenAmount {
+	return big.Sum(o.BaseFeeBurn, o.OverEstimationBurn, o.MinerPenalty)
+}
+
+// ComputeGasOutputs returns how the gas fee of an executed message was split, with the rules of the
+// Filecoin VM. baseFee is the parent base fee of the tipset that included the message.
+func ComputeGasOutputs(msg *types.Message, receipt *types.MessageReceipt, baseFee abi.TokenAmount) GasOutputs {
+	gasUsed := big.NewInt(receipt.GasUsed)
+	out := GasOutputs{
+		BaseFeeBurn:        big.Zero(),
+		OverEstimationBurn: big.Zero(),
+		MinerPenalty:       big.Zero(),
+		MinerTip:           big.Zero(),
+	}
+
+	baseFeeToPay := baseFee
+	if baseFee.GreaterThan(msg.GasFeeCap) {
+		baseFeeToPay = msg.GasFeeCap
+		out.MinerPenalty = big.Mul(big.Sub(baseFee, msg.GasFeeCap), gasUsed)
+	}
+	out.BaseFeeBurn = big.Mul(baseFeeToPay, gasUsed)
+
+	minerTip := big.Min(msg.GasPremium, big.Sub(msg.GasFeeCap, baseFeeToPay))
+	if minerTip.LessThan(big.Zero()) {
+		minerTip = big.Zero()
+	}
+	out.MinerTip = big.Mul(minerTip, big.NewInt(msg.GasLimit))
+
+	if burned := gasOverestimationBurn(receipt.GasUsed, msg.GasLimit); burned != 0 {
+		gasBurned := big.NewInt(burned)
+		out.OverEstimationBurn = big.Mul(baseFeeToPay, gasBurned)
+		out.MinerPenalty = big.Add(out.MinerPenalty, big.Mul(big.Sub(baseFee, baseFeeToPay), gasBurned))
+	}
+
+	return out
+}
+
+// gasOverestimationBurn returns the gas charged for over-estimating the gas limit of a message
+func gasOverestimationBurn(gasUsed, gasLimit int64) int64 {
+	if gasUsed == 0 {
+		return gasLimit
+	}
+
+	over := gasLimit - (gasOveruseNum*gasUsed)/gasOveruseDenom
+	if over < 0 {
+		return 0
+	}
+
+	over = min(over, gasUsed)
+
+	burned := big.Mul(big.NewInt(gasLimit-gasUsed), big.NewInt(over))
+	return big.Div(burned, big.NewInt(gasUsed)).Int64()
+}
@@ -0,0 +1,45 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+func TestComputeGasOutputs(t *testing.T) {
+	tests := []struct {
+		name         string
+		gasLimit     int64
+		gasUsed      int64
+		feeCap       int64
+		wantBaseBurn int64
+		wantOverBurn int64
+		wantPenalty  int64
+		wantTip      int64
+	}{
+		{name: "within 10%", gasLimit: 1000, gasUsed: 1000, feeCap: 200, wantBaseBurn: 100000, wantTip: 10000},
+		{name: "partly over-estimated", gasLimit: 1500, gasUsed: 1000, feeCap: 200, wantBaseBurn: 100000, wantOverBurn: 20000, wantTip: 15000},
+		{name: "fully over-estimated", gasLimit: 3000, gasUsed: 1000, feeCap: 200, wantBaseBurn: 100000, wantOverBurn: 200000, wantTip: 30000},
+		{name: "no gas used", gasLimit: 500, gasUsed: 0, feeCap: 200, wantOverBurn: 50000, wantTip: 5000},
+		{name: "fee cap below base fee", gasLimit: 1000, gasUsed: 1000, feeCap: 50, wantBaseBurn: 50000, wantPenalty: 50000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &types.Message{GasLimit: tt.gasLimit, GasFeeCap: big.NewInt(tt.feeCap), GasPremium: big.NewInt(10)}
+			out := ComputeGasOutputs(msg, &types.MessageReceipt{GasUsed: tt.gasUsed}, abi.NewTokenAmount(100))
+
+			if !out.BaseFeeBurn.Equals(big.NewInt(tt.wantBaseBurn)) || !out.OverEstimationBurn.Equals(big.NewInt(tt.wantOverBurn)) {
+				t.Errorf("unexpected burns %s and %s", out.BaseFeeBurn, out.OverEstimationBurn)
+			}
+			if !out.MinerPenalty.Equals(big.NewInt(tt.wantPenalty)) || !out.MinerTip.Equals(big.NewInt(tt.wantTip)) {
+				t.Errorf("unexpected penalty %s or tip %s", out.MinerPenalty, out.MinerTip)
+			}
+			if !out.Burned().Equals(big.NewInt(tt.wantBaseBurn + tt.wantOverBurn + tt.wantPenalty)) {
+				t.Errorf("unexpected total burn %s", out.Burned())
+			}
+		})
+	}
+}
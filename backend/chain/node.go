@@ -2,15 +2,19 @@ package chain
 
 import (
 	"context"
+	"errors"
 
 	"github.com/filecoin-project/go-jsonrpc"
 	v1 "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
 )
 
+// ErrF3NotRunning is returned when the node can't provide F3 finality
+var ErrF3NotRunning = errors.New("f3 is not running")
+
 // Node wraps the Filecoin full node API client
 type Node struct {
 	ctx context.Context
-	v1.FullNode
+	ChainSource
 	closer jsonrpc.ClientCloser
 }
 
@@ -22,15 +26,37 @@ func NewNode(ctx context.Context, url string, token string) (*Node, error) {
 	}
 
 	return &Node{
-		ctx:      ctx,
-		FullNode: node,
-		closer:   closer,
+		ctx:         ctx,
+		ChainSource: node,
+		closer:      closer,
+	}, nil
+}
+
+// NewPoolNode creates a new Node instance backed by a Pool of full nodes
+func NewPoolNode(ctx context.Context, cfg PoolConfig) (*Node, error) {
+	pool, err := NewPool(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{
+		ctx:         ctx,
+		ChainSource: pool,
+		closer:      pool.Close,
 	}, nil
 }
 
+// NewNodeFromSource creates a new Node instance on top of an existing ChainSource
+func NewNodeFromSource(ctx context.Context, source ChainSource) *Node {
+	return &Node{
+		ctx:         ctx,
+		ChainSource: source,
+	}
+}
+
 // ChainHeadHeight returns the current chain head height
 func (n *Node) ChainHeadHeight() (int64, error) {
-	head, err := n.FullNode.ChainHead(n.ctx)
+	head, err := n.ChainSource.ChainHead(n.ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -38,7 +64,29 @@ func (n *Node) ChainHeadHeight() (int64, error) {
 	return int64(head.Height()), nil
 }
 
+// F3FinalizedHeight returns the height of the latest tipset finalized by F3, it returns
+// ErrF3NotRunning if the node has F3 disabled or not running yet
+func (n *Node) F3FinalizedHeight() (int64, error) {
+	running, err := n.ChainSource.F3IsRunning(n.ctx)
+	if err != nil || !running {
+		return 0, errors.Join(ErrF3NotRunning, err)
+	}
+
+	cert, err := n.ChainSource.F3GetLatestCertificate(n.ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if cert == nil || cert.ECChain.IsZero() {
+		return 0, ErrF3NotRunning
+	}
+
+	return cert.ECChain.Head().Epoch, nil
+}
+
 // Close closes the client connection
 func (n *Node) Close() {
-	n.closer()
+	if n.closer != nil {
+		n.closer()
+	}
 }
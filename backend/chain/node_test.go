@@ -1,40 +1,72 @@
 package chain
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"testing"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/builtin"
 	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain/chaintest"
 )
 
 func TestNewNode(t *testing.T) {
-	t.Skip("Skipping test that requires a running lotus node")
 	ctx := context.Background()
-	node, err := NewNode(ctx, "http://127.0.0.1:3463", "")
-	if err != nil {
-		t.Fatal(err)
-	}
+	fc := chaintest.NewChain(100)
 
-	height := abi.ChainEpoch(5282426)
-	tipset, err := node.ChainGetTipSetByHeight(ctx, height, types.TipSetKey{})
-	if err != nil {
-		t.Fatal(err)
+	owner, _ := address.NewIDAddress(100)
+	createMiner := &types.Message{
+		From:       owner,
+		To:         builtin.StoragePowerActorAddr,
+		Value:      abi.NewTokenAmount(0),
+		GasLimit:   1000,
+		GasFeeCap:  abi.NewTokenAmount(1),
+		GasPremium: abi.NewTokenAmount(1),
+		Method:     builtin.MethodsPower.CreateMiner,
 	}
+	fc.Add(createMiner)
+	fc.Add()
 
-	for _, blkHeader := range tipset.Blocks() {
-		messages, err := node.ChainGetBlockMessages(ctx, blkHeader.Cid())
+	// the node only sees what was recorded from the chain
+	var recording bytes.Buffer
+	recorder := NewRecorder(fc, &recording)
+	lookup := func(node *Node) []*types.Message {
+		tipset, err := node.ChainGetTipSetByHeight(ctx, 101, types.TipSetKey{})
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		for _, msg := range messages.BlsMessages {
-			if msg.To == builtin.StoragePowerActorAddr && msg.Method == builtin.MethodsPower.CreateMiner {
-				fmt.Printf("CreateMiner message found: From %s -> To %s, Method %d\n",
-					msg.From, msg.To, msg.Method)
+		var found []*types.Message
+		for _, blkHeader := range tipset.Blocks() {
+			messages, err := node.ChainGetBlockMessages(ctx, blkHeader.Cid())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, msg := range messages.BlsMessages {
+				if msg.To == builtin.StoragePowerActorAddr && msg.Method == builtin.MethodsPower.CreateMiner {
+					found = append(found, msg)
+				}
 			}
 		}
+		return found
+	}
+
+	lookup(NewNodeFromSource(ctx, recorder))
+	if err := recorder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := lookup(NewNodeFromSource(ctx, replay))
+	if len(found) != 1 || found[0].Cid() != createMiner.Cid() {
+		t.Fatalf("expected the CreateMiner message, got %v", found)
 	}
 }
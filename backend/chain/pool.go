@@ -0,0 +1,398 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	v1 "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	defaultMaxLag              = 5
+	defaultHealthCheckInterval = 10
+	// scoreDecay is the weight of the previous score when a call result is folded into it
+	scoreDecay = 0.9
+)
+
+// poolMetrics exposes the state of every pool endpoint through expvar
+var poolMetrics = expvar.NewMap("node_pool")
+
+// EndpointConfig defines a full node endpoint
+type EndpointConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
+// PoolConfig defines the full nodes used by a Pool
+type PoolConfig struct {
+	Endpoints []EndpointConfig `yaml:"endpoints"`
+	// MaxLag is the number of epochs an endpoint may be behind the highest known head and still be healthy
+	MaxLag int64 `yaml:"max_lag"`
+	// HealthCheckInterval is the number of seconds between two health checks
+	HealthCheckInterval int64 `yaml:"health_check_interval"`
+}
+
+// EndpointStatus is a snapshot of the health of a pool endpoint
+type EndpointStatus struct {
+	URL       string  `json:"url"`
+	Healthy   bool    `json:"healthy"`
+	Height    int64   `json:"height"`
+	Lag       int64   `json:"lag"`
+	Score     float64 `json:"score"`
+	Calls     uint64  `json:"calls"`
+	Failures  uint64  `json:"failures"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+type endpoint struct {
+	url    string
+	source ChainSource
+	closer jsonrpc.ClientCloser
+
+	lk     sync.Mutex
+	status EndpointStatus
+}
+
+// record folds the result of a call into the endpoint score, only transient errors count as failures
+func (e *endpoint) record(err error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	e.status.Calls++
+	if isTransient(err) {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		e.status.Score = e.status.Score * scoreDecay
+		return
+	}
+
+	e.status.Score = e.status.Score*scoreDecay + (1 - scoreDecay)
+}
+
+func (e *endpoint) snapshot() EndpointStatus {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	return e.status
+}
+
+// Pool is a ChainSource backed by several full nodes. It routes every call to the healthiest node and
+// retries failed calls on the next one, as a lagging node may miss data the others have. A node is unhealthy when its head can't be fetched or when
+// it lags more than MaxLag epochs behind the highest head of the pool.
+type Pool struct {
+	ctx       context.Context
+	cfg       PoolConfig
+	endpoints []*endpoint
+}
+
+// NewPool dials all the endpoints of cfg, endpoints which fail to dial are skipped
+func NewPool(ctx context.Context, cfg PoolConfig) (*Pool, error) {
+	var endpoints []*endpoint
+	for _, ec := range cfg.Endpoints {
+		node, closer, err := v1.DialFullNodeRPC(ctx, ec.URL, ec.Token, nil)
+		if err != nil {
+			slog.Error("failed to dial node, skipping it", "url", ec.URL, "error", err)
+			continue
+		}
+
+		endpoints = append(endpoints, &endpoint{
+			url:    ec.URL,
+			source: node,
+			closer: closer,
+		})
+	}
+
+	if len(endpoints) == 0 {
+		return nil, errors.New("no node endpoint available")
+	}
+
+	return newPool(ctx, cfg, endpoints), nil
+}
+
+func newPool(ctx context.Context, cfg PoolConfig, endpoints []*endpoint) *Pool {
+	if cfg.MaxLag <= 0 {
+		cfg.MaxLag = defaultMaxLag
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	p := &Pool{
+		ctx:       ctx,
+		cfg:       cfg,
+		endpoints: endpoints,
+	}
+
+	for _, e := range endpoints {
+		e.status.URL = e.url
+		e.status.Healthy = true
+		e.status.Score = 1
+		poolMetrics.Set(e.url, expvar.Func(func() any { return e.snapshot() }))
+	}
+
+	p.checkHealth()
+	go p.healthLoop()
+
+	return p
+}
+
+// Status returns a snapshot of the health of all endpoints
+func (p *Pool) Status() []EndpointStatus {
+	status := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		status = append(status, e.snapshot())
+	}
+
+	return status
+}
+
+func (p *Pool) healthLoop() {
+	ticker := time.NewTicker(time.Duration(p.cfg.HealthCheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.checkHealth()
+
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth fetches the head of every endpoint and updates their health and lag
+func (p *Pool) checkHealth() {
+	heights := make([]int64, len(p.endpoints))
+	errs := make([]error, len(p.endpoints))
+
+	var wg sync.WaitGroup
+	for idx, e := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(p.ctx, time.Duration(p.cfg.HealthCheckInterval)*time.Second)
+			defer cancel()
+
+			head, err := e.source.ChainHead(ctx)
+			if err != nil {
+				errs[idx] = err
+				return
+			}
+			heights[idx] = int64(head.Height())
+		}()
+	}
+	wg.Wait()
+
+	maxHeight := slices.Max(heights)
+	for idx, e := range p.endpoints {
+		e.lk.Lock()
+		wasHealthy := e.status.Healthy
+		if errs[idx] != nil {
+			e.status.Healthy = false
+			e.status.LastError = errs[idx].Error()
+		} else {
+			e.status.Height = heights[idx]
+			e.status.Lag = maxHeight - heights[idx]
+			e.status.Healthy = e.status.Lag <= p.cfg.MaxLag
+		}
+		status := e.status
+		e.lk.Unlock()
+
+		if wasHealthy != status.Healthy {
+			slog.Warn("node endpoint health changed", "url", status.URL, "healthy", status.Healthy,
+				"height", status.Height, "lag", status.Lag, "error", status.LastError)
+		}
+	}
+
+	slog.Debug("node pool status", "endpoints", p.Status())
+}
+
+// candidates returns the endpoints in the order calls should try them: healthy ones first, then by
+// descending score and ascending lag
+func (p *Pool) candidates() []*endpoint {
+	type candidate struct {
+		e      *endpoint
+		status EndpointStatus
+	}
+
+	cands := make([]candidate, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		cands = append(cands, candidate{e: e, status: e.snapshot()})
+	}
+
+	slices.SortStableFunc(cands, func(a, b candidate) int {
+		switch {
+		case a.status.Healthy != b.status.Healthy:
+			if a.status.Healthy {
+				return -1
+			}
+			return 1
+		case a.status.Score != b.status.Score:
+			if a.status.Score > b.status.Score {
+				return -1
+			}
+			return 1
+		default:
+			return int(a.status.Lag - b.status.Lag)
+		}
+	})
+
+	out := make([]*endpoint, 0, len(cands))
+	for _, c := range cands {
+		out = append(out, c.e)
+	}
+
+	return out
+}
+
+// call runs fn on the best endpoint, moving on to the next one as long as it fails. The errors of all
+// endpoints are returned when none of them succeeds.
+func call[T any](p *Pool, fn func(ChainSource) (T, error)) (T, error) {
+	var zero T
+	var errs error
+	for _, e := range p.candidates() {
+		res, err := fn(e.source)
+		e.record(err)
+		if err == nil {
+			return res, nil
+		}
+
+		errs = errors.Join(errs, fmt.Errorf("%s: %w", e.url, err))
+	}
+
+	return zero, errs
+}
+
+func (p *Pool) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return call(p, func(s ChainSource) (*types.TipSet, error) {
+		return s.ChainHead(ctx)
+	})
+}
+
+func (p *Pool) ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return call(p, func(s ChainSource) (*types.TipSet, error) {
+		return s.ChainGetTipSetByHeight(ctx, height, tsk)
+	})
+}
+
+func (p *Pool) ChainGetTipSetAfterHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return call(p, func(s ChainSource) (*types.TipSet, error) {
+		return s.ChainGetTipSetAfterHeight(ctx, height, tsk)
+	})
+}
+
+func (p *Pool) ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	return call(p, func(s ChainSource) (*types.BlockMessages, error) {
+		return s.ChainGetBlockMessages(ctx, bcid)
+	})
+}
+
+func (p *Pool) ChainGetParentMessages(ctx context.Context, bcid cid.Cid) ([]types.MessageCID, error) {
+	return call(p, func(s ChainSource) ([]types.MessageCID, error) {
+		return s.ChainGetParentMessages(ctx, bcid)
+	})
+}
+
+func (p *Pool) ChainGetParentReceipts(ctx context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error) {
+	return call(p, func(s ChainSource) ([]*types.MessageReceipt, error) {
+		return s.ChainGetParentReceipts(ctx, bcid)
+	})
+}
+
+// ChainNotify subscribes to head changes on the best endpoint which accepts the subscription
+func (p *Pool) ChainNotify(ctx context.Context) (<-chan []*types.HeadChange, error) {
+	return call(p, func(s ChainSource) (<-chan []*types.HeadChange, error) {
+		return s.ChainNotify(ctx)
+	})
+}
+
+func (p *Pool) GetActorEventsRaw(ctx context.Context, filter *types.ActorEventFilter) ([]*types.ActorEvent, error) {
+	return call(p, func(s ChainSource) ([]*types.ActorEvent, error) {
+		return s.GetActorEventsRaw(ctx, filter)
+	})
+}
+
+func (p *Pool) StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	return call(p, func(s ChainSource) (*types.Actor, error) {
+		return s.StateGetActor(ctx, actor, tsk)
+	})
+}
+
+func (p *Pool) StateCompute(ctx context.Context, height abi.ChainEpoch, msgs []*types.Message, tsk types.TipSetKey) (*types.ComputeStateOutput, error) {
+	return call(p, func(s ChainSource) (*types.ComputeStateOutput, error) {
+		return s.StateCompute(ctx, height, msgs, tsk)
+	})
+}
+
+func (p *Pool) StateListMiners(ctx context.Context, tsk types.TipSetKey) ([]address.Address, error) {
+	return call(p, func(s ChainSource) ([]address.Address, error) {
+		return s.StateListMiners(ctx, tsk)
+	})
+}
+
+func (p *Pool) StateMinerDeadlines(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]types.Deadline, error) {
+	return call(p, func(s ChainSource) ([]types.Deadline, error) {
+		return s.StateMinerDeadlines(ctx, maddr, tsk)
+	})
+}
+
+func (p *Pool) StateVMCirculatingSupplyInternal(ctx context.Context, tsk types.TipSetKey) (types.CirculatingSupply, error) {
+	return call(p, func(s ChainSource) (types.CirculatingSupply, error) {
+		return s.StateVMCirculatingSupplyInternal(ctx, tsk)
+	})
+}
+
+func (p *Pool) StateMinerPower(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.MinerPower, error) {
+	return call(p, func(s ChainSource) (*types.MinerPower, error) {
+		return s.StateMinerPower(ctx, addr, tsk)
+	})
+}
+
+func (p *Pool) StateMinerInitialPledgeForSector(ctx context.Context, sectorDuration abi.ChainEpoch, sectorSize abi.SectorSize, verifiedSize uint64, tsk types.TipSetKey) (types.BigInt, error) {
+	return call(p, func(s ChainSource) (types.BigInt, error) {
+		return s.StateMinerInitialPledgeForSector(ctx, sectorDuration, sectorSize, verifiedSize, tsk)
+	})
+}
+
+func (p *Pool) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	return call(p, func(s ChainSource) ([]byte, error) {
+		return s.ChainReadObj(ctx, c)
+	})
+}
+
+func (p *Pool) F3IsRunning(ctx context.Context) (bool, error) {
+	return call(p, func(s ChainSource) (bool, error) {
+		return s.F3IsRunning(ctx)
+	})
+}
+
+func (p *Pool) F3GetLatestCertificate(ctx context.Context) (*certs.FinalityCertificate, error) {
+	return call(p, func(s ChainSource) (*certs.FinalityCertificate, error) {
+		return s.F3GetLatestCertificate(ctx)
+	})
+}
+
+// Close closes the connections to all endpoints
+func (p *Pool) Close() {
+	for _, e := range p.endpoints {
+		if e.closer != nil {
+			e.closer()
+		}
+	}
+}
+
+var _ ChainSource = (*Pool)(nil)
@@ -0,0 +1,116 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+// flakySource fails every call it overrides with err
+type flakySource struct {
+	*chaintest.Chain
+	err error
+}
+
+func (f *flakySource) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Chain.ChainHead(ctx)
+}
+
+func (f *flakySource) ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Chain.ChainGetBlockMessages(ctx, bcid)
+}
+
+func TestPoolFailover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fc := chaintest.NewChain(100)
+	ts := fc.Add()
+
+	flaky := &flakySource{Chain: fc}
+	pool := newPool(ctx, PoolConfig{}, []*endpoint{
+		{url: "flaky", source: flaky},
+		{url: "healthy", source: fc},
+	})
+
+	// both endpoints are healthy and equally scored, so the first one is used
+	if _, err := pool.ChainGetBlockMessages(ctx, ts.Cids()[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// a transient error is retried on the other endpoint
+	flaky.err = syscall.ECONNRESET
+	if _, err := pool.ChainGetBlockMessages(ctx, ts.Cids()[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	status := pool.Status()
+	if status[0].Failures != 1 || status[0].Score >= status[1].Score {
+		t.Fatalf("unexpected pool status %+v", status)
+	}
+
+	// a permanent error, such as a lagging node missing a block, is retried on the other endpoint too
+	flaky.err = errors.New("block not found")
+	pool.endpoints[1].status.Score = 0
+	if _, err := pool.ChainGetBlockMessages(ctx, ts.Cids()[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the errors of all endpoints are returned when they all fail
+	if _, err := pool.ChainGetBlockMessages(ctx, cid.Undef); err == nil ||
+		!strings.Contains(err.Error(), "flaky: block not found") || !strings.Contains(err.Error(), "healthy: ") {
+		t.Fatalf("expected the errors of both endpoints, got %v", err)
+	}
+
+	// an endpoint which can't return its head is unhealthy and tried last
+	flaky.err = syscall.ECONNREFUSED
+	pool.checkHealth()
+	if status := pool.Status(); status[0].Healthy || !status[1].Healthy {
+		t.Fatalf("unexpected pool status %+v", status)
+	}
+	if candidates := pool.candidates(); candidates[0].url != "healthy" {
+		t.Fatalf("expected the healthy endpoint first, got %s", candidates[0].url)
+	}
+}
+
+func TestPoolLag(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	behind := chaintest.NewChain(100)
+	ahead := chaintest.NewChain(100)
+	for range 10 {
+		ahead.Add()
+	}
+
+	pool := newPool(ctx, PoolConfig{MaxLag: 5}, []*endpoint{
+		{url: "behind", source: behind},
+		{url: "ahead", source: ahead},
+	})
+
+	status := pool.Status()
+	if status[0].Healthy || status[0].Lag != 10 || !status[1].Healthy {
+		t.Fatalf("unexpected pool status %+v", status)
+	}
+
+	head, err := pool.ChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Height() != 110 {
+		t.Fatalf("expected the head of the healthy endpoint, got %d", head.Height())
+	}
+}
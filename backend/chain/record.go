@@ -0,0 +1,415 @@
+package chain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+)
+
+// errNotRecorded is returned by a Replay for a request that is not in its recording
+var errNotRecorded = errors.New("request not recorded")
+
+// Exchange is a JSON-RPC request and the response the source gave to it, a recording is a file with one
+// Exchange per line
+type Exchange struct {
+	Request  RPCRequest  `json:"request"`
+	Response RPCResponse `json:"response"`
+}
+
+// RPCRequest is a JSON-RPC 2.0 request, without the context argument of the API method
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// RPCResponse is a JSON-RPC 2.0 response, Error is set when the source returned an error
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is the error of a JSON-RPC response, only its message is kept
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Recorder is a ChainSource that forwards every call to another source and writes the request and the
+// response to a file, so that the calls can be served offline by a Replay. ChainNotify is forwarded but
+// not recorded, a subscription can't be replayed.
+type Recorder struct {
+	source ChainSource
+
+	lk  sync.Mutex
+	w   *bufio.Writer
+	id  int64
+	err error
+}
+
+var _ ChainSource = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder of source writing to w, Flush must be called once the calls are done
+func NewRecorder(source ChainSource, w io.Writer) *Recorder {
+	return &Recorder{source: source, w: bufio.NewWriter(w)}
+}
+
+// Flush writes the buffered exchanges and returns the first error met while saving one
+func (r *Recorder) Flush() error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.w.Flush()
+}
+
+func (r *Recorder) save(method string, params []any, result any, callErr error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.id++
+	exchange := Exchange{
+		Request:  RPCRequest{JSONRPC: "2.0", ID: r.id, Method: method},
+		Response: RPCResponse{JSONRPC: "2.0", ID: r.id},
+	}
+
+	exchange.Request.Params, r.err = marshalParams(params)
+	if r.err != nil {
+		return
+	}
+
+	if callErr != nil {
+		exchange.Response.Error = &RPCError{Code: 1, Message: callErr.Error()}
+	} else if exchange.Response.Result, r.err = json.Marshal(result); r.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(&exchange)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// record forwards a call to the source of r and saves it
+func record[T any](r *Recorder, method string, call func() (T, error), params ...any) (T, error) {
+	result, err := call()
+	r.save(method, params, result, err)
+	return result, err
+}
+
+func marshalParams(params []any) (json.RawMessage, error) {
+	if params == nil {
+		params = []any{}
+	}
+
+	return json.Marshal(params)
+}
+
+func (r *Recorder) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return record(r, "Filecoin.ChainHead", func() (*types.TipSet, error) {
+		return r.source.ChainHead(ctx)
+	})
+}
+
+func (r *Recorder) ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return record(r, "Filecoin.ChainGetTipSetByHeight", func() (*types.TipSet, error) {
+		return r.source.ChainGetTipSetByHeight(ctx, height, tsk)
+	}, height, tsk)
+}
+
+func (r *Recorder) ChainGetTipSetAfterHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return record(r, "Filecoin.ChainGetTipSetAfterHeight", func() (*types.TipSet, error) {
+		return r.source.ChainGetTipSetAfterHeight(ctx, height, tsk)
+	}, height, tsk)
+}
+
+func (r *Recorder) ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	return record(r, "Filecoin.ChainGetBlockMessages", func() (*types.BlockMessages, error) {
+		return r.source.ChainGetBlockMessages(ctx, bcid)
+	}, bcid)
+}
+
+func (r *Recorder) ChainGetParentMessages(ctx context.Context, bcid cid.Cid) ([]types.MessageCID, error) {
+	return record(r, "Filecoin.ChainGetParentMessages", func() ([]types.MessageCID, error) {
+		return r.source.ChainGetParentMessages(ctx, bcid)
+	}, bcid)
+}
+
+func (r *Recorder) ChainGetParentReceipts(ctx context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error) {
+	return record(r, "Filecoin.ChainGetParentReceipts", func() ([]*types.MessageReceipt, error) {
+		return r.source.ChainGetParentReceipts(ctx, bcid)
+	}, bcid)
+}
+
+func (r *Recorder) ChainNotify(ctx context.Context) (<-chan []*types.HeadChange, error) {
+	return r.source.ChainNotify(ctx)
+}
+
+func (r *Recorder) GetActorEventsRaw(ctx context.Context, filter *types.ActorEventFilter) ([]*types.ActorEvent, error) {
+	return record(r, "Filecoin.GetActorEventsRaw", func() ([]*types.ActorEvent, error) {
+		return r.source.GetActorEventsRaw(ctx, filter)
+	}, filter)
+}
+
+func (r *Recorder) StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	return record(r, "Filecoin.StateGetActor", func() (*types.Actor, error) {
+		return r.source.StateGetActor(ctx, actor, tsk)
+	}, actor, tsk)
+}
+
+func (r *Recorder) StateCompute(ctx context.Context, height abi.ChainEpoch, msgs []*types.Message, tsk types.TipSetKey) (*types.ComputeStateOutput, error) {
+	return record(r, "Filecoin.StateCompute", func() (*types.ComputeStateOutput, error) {
+		return r.source.StateCompute(ctx, height, msgs, tsk)
+	}, height, msgs, tsk)
+}
+
+func (r *Recorder) StateListMiners(ctx context.Context, tsk types.TipSetKey) ([]address.Address, error) {
+	return record(r, "Filecoin.StateListMiners", func() ([]address.Address, error) {
+		return r.source.StateListMiners(ctx, tsk)
+	}, tsk)
+}
+
+func (r *Recorder) StateMinerDeadlines(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]types.Deadline, error) {
+	return record(r, "Filecoin.StateMinerDeadlines", func() ([]types.Deadline, error) {
+		return r.source.StateMinerDeadlines(ctx, maddr, tsk)
+	}, maddr, tsk)
+}
+
+func (r *Recorder) StateVMCirculatingSupplyInternal(ctx context.Context, tsk types.TipSetKey) (types.CirculatingSupply, error) {
+	return record(r, "Filecoin.StateVMCirculatingSupplyInternal", func() (types.CirculatingSupply, error) {
+		return r.source.StateVMCirculatingSupplyInternal(ctx, tsk)
+	}, tsk)
+}
+
+func (r *Recorder) StateMinerPower(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.MinerPower, error) {
+	return record(r, "Filecoin.StateMinerPower", func() (*types.MinerPower, error) {
+		return r.source.StateMinerPower(ctx, addr, tsk)
+	}, addr, tsk)
+}
+
+func (r *Recorder) StateMinerInitialPledgeForSector(ctx context.Context, sectorDuration abi.ChainEpoch, sectorSize abi.SectorSize, verifiedSize uint64, tsk types.TipSetKey) (types.BigInt, error) {
+	return record(r, "Filecoin.StateMinerInitialPledgeForSector", func() (types.BigInt, error) {
+		return r.source.StateMinerInitialPledgeForSector(ctx, sectorDuration, sectorSize, verifiedSize, tsk)
+	}, sectorDuration, sectorSize, verifiedSize, tsk)
+}
+
+func (r *Recorder) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	return record(r, "Filecoin.ChainReadObj", func() ([]byte, error) {
+		return r.source.ChainReadObj(ctx, c)
+	}, c)
+}
+
+func (r *Recorder) F3IsRunning(ctx context.Context) (bool, error) {
+	return record(r, "Filecoin.F3IsRunning", func() (bool, error) {
+		return r.source.F3IsRunning(ctx)
+	})
+}
+
+func (r *Recorder) F3GetLatestCertificate(ctx context.Context) (*certs.FinalityCertificate, error) {
+	return record(r, "Filecoin.F3GetLatestCertificate", func() (*certs.FinalityCertificate, error) {
+		return r.source.F3GetLatestCertificate(ctx)
+	})
+}
+
+// Replay is a ChainSource serving the responses saved by a Recorder. A request recorded several times, such
+// as ChainHead or a retried request, gets the responses in the order they were recorded, then the last one.
+type Replay struct {
+	lk        sync.Mutex
+	responses map[string]*replayQueue
+}
+
+var _ ChainSource = (*Replay)(nil)
+
+type replayQueue struct {
+	responses []RPCResponse
+	next      int
+}
+
+// OpenReplay reads the recording at path
+func OpenReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplay(f)
+}
+
+// NewReplay reads a recording from r
+func NewReplay(r io.Reader) (*Replay, error) {
+	replay := &Replay{responses: make(map[string]*replayQueue)}
+
+	dec := json.NewDecoder(r)
+	for {
+		var exchange Exchange
+		if err := dec.Decode(&exchange); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid recording: %w", err)
+		}
+
+		// params are compacted so that a recording edited by hand still matches
+		key, err := replayKey(exchange.Request.Method, exchange.Request.Params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid params of request %d: %w", exchange.Request.ID, err)
+		}
+
+		q, ok := replay.responses[key]
+		if !ok {
+			q = &replayQueue{}
+			replay.responses[key] = q
+		}
+		q.responses = append(q.responses, exchange.Response)
+	}
+
+	return replay, nil
+}
+
+func replayKey(method string, params json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, params); err != nil {
+		return "", err
+	}
+
+	return method + buf.String(), nil
+}
+
+// serve returns the next recorded response to a request
+func serve[T any](r *Replay, method string, params ...any) (T, error) {
+	var result T
+
+	raw, err := marshalParams(params)
+	if err != nil {
+		return result, err
+	}
+
+	key, err := replayKey(method, raw)
+	if err != nil {
+		return result, err
+	}
+
+	r.lk.Lock()
+	q, ok := r.responses[key]
+	var response RPCResponse
+	if ok {
+		response = q.responses[q.next]
+		if q.next < len(q.responses)-1 {
+			q.next++
+		}
+	}
+	r.lk.Unlock()
+
+	if !ok {
+		return result, fmt.Errorf("%s %s: %w", method, raw, errNotRecorded)
+	}
+
+	if response.Error != nil {
+		return result, errors.New(response.Error.Message)
+	}
+
+	if err := json.Unmarshal(response.Result, &result); err != nil {
+		return result, fmt.Errorf("invalid result of %s %s: %w", method, raw, err)
+	}
+
+	return result, nil
+}
+
+func (r *Replay) ChainHead(_ context.Context) (*types.TipSet, error) {
+	return serve[*types.TipSet](r, "Filecoin.ChainHead")
+}
+
+func (r *Replay) ChainGetTipSetByHeight(_ context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return serve[*types.TipSet](r, "Filecoin.ChainGetTipSetByHeight", height, tsk)
+}
+
+func (r *Replay) ChainGetTipSetAfterHeight(_ context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	return serve[*types.TipSet](r, "Filecoin.ChainGetTipSetAfterHeight", height, tsk)
+}
+
+func (r *Replay) ChainGetBlockMessages(_ context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	return serve[*types.BlockMessages](r, "Filecoin.ChainGetBlockMessages", bcid)
+}
+
+func (r *Replay) ChainGetParentMessages(_ context.Context, bcid cid.Cid) ([]types.MessageCID, error) {
+	return serve[[]types.MessageCID](r, "Filecoin.ChainGetParentMessages", bcid)
+}
+
+func (r *Replay) ChainGetParentReceipts(_ context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error) {
+	return serve[[]*types.MessageReceipt](r, "Filecoin.ChainGetParentReceipts", bcid)
+}
+
+func (r *Replay) ChainNotify(_ context.Context) (<-chan []*types.HeadChange, error) {
+	return nil, fmt.Errorf("Filecoin.ChainNotify: %w", errNotRecorded)
+}
+
+func (r *Replay) GetActorEventsRaw(_ context.Context, filter *types.ActorEventFilter) ([]*types.ActorEvent, error) {
+	return serve[[]*types.ActorEvent](r, "Filecoin.GetActorEventsRaw", filter)
+}
+
+func (r *Replay) StateGetActor(_ context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	return serve[*types.Actor](r, "Filecoin.StateGetActor", actor, tsk)
+}
+
+func (r *Replay) StateCompute(_ context.Context, height abi.ChainEpoch, msgs []*types.Message, tsk types.TipSetKey) (*types.ComputeStateOutput, error) {
+	return serve[*types.ComputeStateOutput](r, "Filecoin.StateCompute", height, msgs, tsk)
+}
+
+func (r *Replay) StateListMiners(_ context.Context, tsk types.TipSetKey) ([]address.Address, error) {
+	return serve[[]address.Address](r, "Filecoin.StateListMiners", tsk)
+}
+
+func (r *Replay) StateMinerDeadlines(_ context.Context, maddr address.Address, tsk types.TipSetKey) ([]types.Deadline, error) {
+	return serve[[]types.Deadline](r, "Filecoin.StateMinerDeadlines", maddr, tsk)
+}
+
+func (r *Replay) StateVMCirculatingSupplyInternal(_ context.Context, tsk types.TipSetKey) (types.CirculatingSupply, error) {
+	return serve[types.CirculatingSupply](r, "Filecoin.StateVMCirculatingSupplyInternal", tsk)
+}
+
+func (r *Replay) StateMinerPower(_ context.Context, addr address.Address, tsk types.TipSetKey) (*types.MinerPower, error) {
+	return serve[*types.MinerPower](r, "Filecoin.StateMinerPower", addr, tsk)
+}
+
+func (r *Replay) StateMinerInitialPledgeForSector(_ context.Context, sectorDuration abi.ChainEpoch, sectorSize abi.SectorSize, verifiedSize uint64, tsk types.TipSetKey) (types.BigInt, error) {
+	return serve[types.BigInt](r, "Filecoin.StateMinerInitialPledgeForSector", sectorDuration, sectorSize, verifiedSize, tsk)
+}
+
+func (r *Replay) ChainReadObj(_ context.Context, c cid.Cid) ([]byte, error) {
+	return serve[[]byte](r, "Filecoin.ChainReadObj", c)
+}
+
+func (r *Replay) F3IsRunning(_ context.Context) (bool, error) {
+	return serve[bool](r, "Filecoin.F3IsRunning")
+}
+
+func (r *Replay) F3GetLatestCertificate(_ context.Context) (*certs.FinalityCertificate, error) {
+	return serve[*certs.FinalityCertificate](r, "Filecoin.F3GetLatestCertificate")
+}
@@ -0,0 +1,103 @@
+package chain_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+// traceRecords syncs every executed epoch of node with tracing and describes the calls received
+func traceRecords(t *testing.T, node *chain.Node) []string {
+	t.Helper()
+
+	var records []string
+	err := node.SyncBlocks(101, 0, nil, chain.WithTrace(true), chain.WithCallHandler(func(blockMeta *chain.BlockMeta, call *chain.Call) error {
+		records = append(records, fmt.Sprintf("call %d %s %d %s %d %d", blockMeta.Height, call.MsgCid, call.Index, call.To, call.Method, call.ExitCode))
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	multisig, _ := address.NewIDAddress(200)
+	propose := newMessage(0)
+	propose.To = multisig
+	propose.Method = builtin.MethodsMultisig.Propose
+	fc.SetSubcalls(propose.Cid(), types.ExecutionTrace{
+		Msg: types.MessageTrace{
+			From:   multisig,
+			To:     builtin.StoragePowerActorAddr,
+			Value:  abi.NewTokenAmount(0),
+			Method: builtin.MethodsPower.CreateMiner,
+		},
+	})
+
+	failed := newMessage(1)
+	fc.Add(propose, failed)
+	fc.NullRounds(2)
+	fc.AddTipSet(
+		&types.BlockMessages{BlsMessages: []*types.Message{newMessage(2)}},
+		&types.BlockMessages{BlsMessages: []*types.Message{newMessage(2), newMessage(3)}},
+	)
+	fc.Add()
+	fc.SetReceipt(failed.Cid(), &types.MessageReceipt{ExitCode: exitcode.ErrInsufficientFunds, GasUsed: 10})
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := chain.NewRecorder(fc, file)
+	recorded := chain.NewNodeFromSource(ctx, recorder)
+	want := append(syncRecords(t, recorded), traceRecords(t, recorded)...)
+	if err := recorder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(want) != 13 {
+		t.Fatalf("expected 4 messages, 3 tipsets, 2 null rounds and 4 calls, got %v", want)
+	}
+
+	replay, err := chain.OpenReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := chain.NewNodeFromSource(ctx, replay)
+	got := append(syncRecords(t, replayed), traceRecords(t, replayed)...)
+	if !slices.Equal(want, got) {
+		t.Fatalf("replay differs from the recording\nwant %v\ngot  %v", want, got)
+	}
+
+	// the chain is not reachable from the replay, a request that was not recorded fails
+	head, err := replay.ChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replay.ChainGetTipSetByHeight(ctx, 50, head.Key()); err == nil {
+		t.Fatal("expected an error for a request that was not recorded")
+	}
+}
@@ -0,0 +1,50 @@
+package chain
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+// defaultRetries is the default number of times a transient failure is retried for one epoch
+const defaultRetries = 5
+
+// minRetryBackoff and maxRetryBackoff bound the delay before retrying an epoch, they are variables
+// so that tests can shorten them
+var (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// fetchEpochWithRetry fetches an epoch, retrying up to options.retries times with exponential backoff and
+// jitter while the failure is transient. Permanent errors are returned right away.
+func (n *Node) fetchEpochWithRetry(ctx context.Context, anchor types.TipSetKey, epoch int64, options *syncOptions) (*epochData, error) {
+	backoff := minRetryBackoff
+	for attempt := 1; ; attempt++ {
+		data, err := n.fetchEpoch(ctx, anchor, epoch, options)
+		if err == nil || !isTransient(err) || attempt > options.retries {
+			return data, err
+		}
+
+		delay := jitter(backoff)
+		slog.Warn("transient error fetching epoch, retrying", slog.Int64("epoch", epoch), slog.Int("attempt", attempt),
+			slog.Duration("retryIn", delay), "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// jitter returns a random duration between half of d and d, so that epochs failing together don't all
+// retry at the same time
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+// failingSource fails the first failures calls to ChainGetBlockMessages with err
+type failingSource struct {
+	*chaintest.Chain
+	err      error
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *failingSource) ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, f.err
+	}
+	return f.Chain.ChainGetBlockMessages(ctx, bcid)
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: syscall.ECONNRESET, want: true},
+		{err: fmt.Errorf("get messages: %w", io.ErrUnexpectedEOF), want: true},
+		{err: context.DeadlineExceeded, want: true},
+		{err: errors.New("RPC client error: sendRequest failed: http status 503 Service Unavailable"), want: true},
+		{err: errors.New("http status 429 Too Many Requests"), want: true},
+		{err: context.Canceled},
+		{err: errors.New("blockstore: block not found")},
+		{err: errors.New("http status 401 Unauthorized")},
+		{err: nil},
+	}
+
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v): expected %v, got %v", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestSyncBlocksRetry(t *testing.T) {
+	minRetryBackoff, maxRetryBackoff = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() {
+		minRetryBackoff, maxRetryBackoff = time.Second, 30*time.Second
+	})
+
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+
+	tests := []struct {
+		name      string
+		err       error
+		failures  int32
+		retries   int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "transient errors retried", err: syscall.ECONNRESET, failures: 3, retries: 3, wantCalls: 4},
+		{name: "retry limit reached", err: syscall.ECONNRESET, failures: 3, retries: 2, wantErr: true, wantCalls: 3},
+		{name: "permanent error", err: errors.New("block not found"), failures: 1, retries: 3, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &failingSource{Chain: fc, err: tt.err, failures: tt.failures}
+			node := NewNodeFromSource(ctx, source)
+
+			err := node.SyncBlocks(101, 101, nil, WithRetries(tt.retries))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if calls := source.calls.Load(); calls != tt.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,655 @@
+package chain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	amt "github.com/filecoin-project/go-amt-ipld/v2"
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/ipld/go-car"
+	"github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// snapshotMetadataVersion is the version of the metadata block that FRC-0108 snapshots use as their root
+const snapshotMetadataVersion = 2
+
+// errNotInSnapshot is returned by the methods which need the state of the chain or a live node
+var errNotInSnapshot = errors.New("not available from a snapshot")
+
+// Snapshot is a ChainSource reading a Filecoin snapshot CAR file (FRC-0108). It serves the block headers,
+// messages and receipts the file contains without any node. Snapshots usually only hold the messages of
+// their most recent epochs, syncing older epochs then fails with a block not found error.
+//
+// The state tree is not used, so tracing, actor lookups, head changes and F3 are not supported. Messages of
+// a tipset are selected like the node does, except that senders are compared as they appear in messages
+// instead of being resolved to their ID address.
+type Snapshot struct {
+	file  *os.File
+	index []snapshotEntry
+	store cbor.IpldStore
+	head  *types.TipSet
+
+	lk sync.Mutex
+	// heights holds the key of every non-null tipset from lowest to the head, filled while walking back
+	heights map[abi.ChainEpoch]types.TipSetKey
+	lowest  *types.TipSet
+}
+
+// snapshotEntry locates a block in the file, key is the end of the multihash of its cid
+type snapshotEntry struct {
+	key    uint64
+	offset int64
+}
+
+var _ ChainSource = (*Snapshot)(nil)
+
+// OpenSnapshot indexes the blocks of the uncompressed CAR file at path, version 1 or 2, and loads its head.
+// The index is kept in memory and takes 16 bytes per block.
+func OpenSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{file: file, heights: make(map[abi.ChainEpoch]types.TipSetKey)}
+	s.store = cbor.NewCborStore(&snapshotBlockstore{s})
+
+	if err := s.open(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("open snapshot %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *Snapshot) open() error {
+	roots, err := s.buildIndex()
+	if err != nil {
+		return err
+	}
+
+	headKey, err := s.headKey(roots)
+	if err != nil {
+		return err
+	}
+
+	if s.head, err = s.loadTipSet(headKey); err != nil {
+		return fmt.Errorf("load head: %w", err)
+	}
+
+	s.lowest = s.head
+	s.heights[s.head.Height()] = s.head.Key()
+	return nil
+}
+
+// buildIndex scans the file once and records the offset of every block, it returns the roots of the CAR
+func (s *Snapshot) buildIndex() ([]cid.Cid, error) {
+	r := &countingReader{r: bufio.NewReaderSize(s.file, 1<<20)}
+	header, err := readCarHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base, limit := int64(0), int64(-1)
+	if header.Version == 2 {
+		// a CARv2 wraps a CARv1 payload: characteristics (16 bytes), then data offset and size
+		var v2 [40]byte
+		if _, err := io.ReadFull(r, v2[:]); err != nil {
+			return nil, fmt.Errorf("read CARv2 header: %w", err)
+		}
+
+		base = int64(binary.LittleEndian.Uint64(v2[16:24]))
+		limit = int64(binary.LittleEndian.Uint64(v2[24:32]))
+		if _, err := s.file.Seek(base, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		r = &countingReader{r: bufio.NewReaderSize(s.file, 1<<20)}
+		if header, err = readCarHeader(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if header.Version != 1 {
+		return nil, fmt.Errorf("unsupported CAR version %d", header.Version)
+	}
+
+	for limit < 0 || r.n < limit {
+		offset := base + r.n
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF || (err == nil && size == 0) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read section at %d: %w", offset, err)
+		}
+
+		n, c, err := cid.CidFromReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("read cid at %d: %w", offset, err)
+		}
+
+		if _, err := r.r.Discard(int(size) - n); err != nil {
+			return nil, fmt.Errorf("read block %s: %w", c, err)
+		}
+		r.n += int64(size) - int64(n)
+
+		s.index = append(s.index, snapshotEntry{key: cidKey(c), offset: offset})
+	}
+
+	slices.SortFunc(s.index, func(a, b snapshotEntry) int {
+		switch {
+		case a.key < b.key:
+			return -1
+		case a.key > b.key:
+			return 1
+		}
+		return 0
+	})
+
+	return header.Roots, nil
+}
+
+// headKey returns the key of the head tipset, which is either the root of the CAR or listed in the
+// FRC-0108 metadata block the root points to
+func (s *Snapshot) headKey(roots []cid.Cid) (types.TipSetKey, error) {
+	if len(roots) == 1 {
+		blk, err := s.get(roots[0])
+		if err != nil {
+			return types.EmptyTSK, err
+		}
+
+		if _, err := types.DecodeBlock(blk.RawData()); err != nil {
+			head, err := decodeSnapshotMetadata(blk.RawData())
+			if err != nil {
+				return types.EmptyTSK, err
+			}
+
+			return types.NewTipSetKey(head...), nil
+		}
+	}
+
+	if len(roots) == 0 {
+		return types.EmptyTSK, errors.New("snapshot has no root")
+	}
+
+	return types.NewTipSetKey(roots...), nil
+}
+
+// decodeSnapshotMetadata decodes the FRC-0108 metadata block [version, head tipset key, f3 data] and
+// returns the head tipset key
+func decodeSnapshotMetadata(data []byte) ([]cid.Cid, error) {
+	cr := cbg.NewCborReader(bytes.NewReader(data))
+	maj, n, err := cr.ReadHeader()
+	if err != nil || maj != cbg.MajArray || n != 3 {
+		return nil, errors.New("snapshot root is neither a block header nor a metadata block")
+	}
+
+	maj, version, err := cr.ReadHeader()
+	if err != nil || maj != cbg.MajUnsignedInt {
+		return nil, errors.New("invalid snapshot metadata version")
+	}
+
+	if version != snapshotMetadataVersion {
+		return nil, fmt.Errorf("unsupported snapshot metadata version %d", version)
+	}
+
+	maj, n, err = cr.ReadHeader()
+	if err != nil || maj != cbg.MajArray || n == 0 {
+		return nil, errors.New("invalid snapshot head tipset key")
+	}
+
+	head := make([]cid.Cid, 0, n)
+	for range n {
+		c, err := cbg.ReadCid(cr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot head tipset key: %w", err)
+		}
+
+		head = append(head, c)
+	}
+
+	return head, nil
+}
+
+// get reads the block c from the file
+func (s *Snapshot) get(c cid.Cid) (blocks.Block, error) {
+	if c.Prefix().MhType == multihash.IDENTITY {
+		decoded, err := multihash.Decode(c.Hash())
+		if err != nil {
+			return nil, err
+		}
+
+		return blocks.NewBlockWithCid(decoded.Digest, c)
+	}
+
+	key := cidKey(c)
+	idx := sort.Search(len(s.index), func(i int) bool { return s.index[i].key >= key })
+
+	// keys are truncated hashes, so several blocks may share one
+	for ; idx < len(s.index) && s.index[idx].key == key; idx++ {
+		found, data, err := s.readSection(s.index[idx].offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if found.Equals(c) {
+			return blocks.NewBlockWithCid(data, c)
+		}
+	}
+
+	return nil, fmt.Errorf("block %s not found in snapshot", c)
+}
+
+// readSection reads the cid and data of the CAR section at offset
+func (s *Snapshot) readSection(offset int64) (cid.Cid, []byte, error) {
+	var prefix [binary.MaxVarintLen64]byte
+	n, err := s.file.ReadAt(prefix[:], offset)
+	if err != nil && err != io.EOF {
+		return cid.Undef, nil, err
+	}
+
+	size, sizeLen := binary.Uvarint(prefix[:n])
+	if sizeLen <= 0 {
+		return cid.Undef, nil, fmt.Errorf("invalid section length at %d", offset)
+	}
+
+	section := make([]byte, size)
+	if _, err := s.file.ReadAt(section, offset+int64(sizeLen)); err != nil {
+		return cid.Undef, nil, err
+	}
+
+	cidLen, c, err := cid.CidFromBytes(section)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	return c, section[cidLen:], nil
+}
+
+func (s *Snapshot) loadHeader(bcid cid.Cid) (*types.BlockHeader, error) {
+	blk, err := s.get(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.DecodeBlock(blk.RawData())
+}
+
+func (s *Snapshot) loadTipSet(key types.TipSetKey) (*types.TipSet, error) {
+	headers := make([]*types.BlockHeader, 0, len(key.Cids()))
+	for _, bcid := range key.Cids() {
+		header, err := s.loadHeader(bcid)
+		if err != nil {
+			return nil, err
+		}
+
+		headers = append(headers, header)
+	}
+
+	return types.NewTipSet(headers)
+}
+
+// walkTo loads the tipsets from the lowest one walked so far back to height, it must be called with the
+// lock held
+func (s *Snapshot) walkTo(height abi.ChainEpoch) error {
+	for s.lowest.Height() > height {
+		if len(s.lowest.Parents().Cids()) == 0 {
+			return fmt.Errorf("epoch %d is below the genesis of the snapshot", height)
+		}
+
+		parent, err := s.loadTipSet(s.lowest.Parents())
+		if err != nil {
+			return fmt.Errorf("walk back to epoch %d: %w", height, err)
+		}
+
+		s.heights[parent.Height()] = parent.Key()
+		s.lowest = parent
+	}
+
+	return nil
+}
+
+// ChainHead returns the head of the snapshot
+func (s *Snapshot) ChainHead(_ context.Context) (*types.TipSet, error) {
+	return s.head, nil
+}
+
+// ChainGetTipSetByHeight returns the tipset at height, or the one before it for a null round. The snapshot
+// holds a single chain, so tsk is ignored.
+func (s *Snapshot) ChainGetTipSetByHeight(_ context.Context, height abi.ChainEpoch, _ types.TipSetKey) (*types.TipSet, error) {
+	if height > s.head.Height() {
+		return nil, fmt.Errorf("epoch %d is above the head of the snapshot", height)
+	}
+
+	s.lk.Lock()
+	if err := s.walkTo(height); err != nil {
+		s.lk.Unlock()
+		return nil, err
+	}
+
+	var key types.TipSetKey
+	for epoch := height; ; epoch-- {
+		if k, ok := s.heights[epoch]; ok {
+			key = k
+			break
+		}
+	}
+	s.lk.Unlock()
+
+	return s.loadTipSet(key)
+}
+
+// ChainGetTipSetAfterHeight returns the tipset at height, or the one after it for a null round
+func (s *Snapshot) ChainGetTipSetAfterHeight(_ context.Context, height abi.ChainEpoch, _ types.TipSetKey) (*types.TipSet, error) {
+	if height > s.head.Height() {
+		return nil, fmt.Errorf("epoch %d is above the head of the snapshot", height)
+	}
+
+	s.lk.Lock()
+	if err := s.walkTo(height); err != nil {
+		s.lk.Unlock()
+		return nil, err
+	}
+
+	var key types.TipSetKey
+	for epoch := height; ; epoch++ {
+		if k, ok := s.heights[epoch]; ok {
+			key = k
+			break
+		}
+	}
+	s.lk.Unlock()
+
+	return s.loadTipSet(key)
+}
+
+// ChainGetBlockMessages returns the messages included in the block bcid
+func (s *Snapshot) ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error) {
+	header, err := s.loadHeader(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	var root types.MessageRoot
+	if err := s.store.Get(ctx, header.Messages, &root); err != nil {
+		return nil, fmt.Errorf("messages of block %s: %w", bcid, err)
+	}
+
+	blsCids, err := s.amtCids(ctx, root.BlsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	secpkCids, err := s.amtCids(ctx, root.SecpkRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := &types.BlockMessages{Cids: append(slices.Clone(blsCids), secpkCids...)}
+	for _, c := range blsCids {
+		var msg types.Message
+		if err := s.store.Get(ctx, c, &msg); err != nil {
+			return nil, fmt.Errorf("message %s: %w", c, err)
+		}
+
+		msgs.BlsMessages = append(msgs.BlsMessages, &msg)
+	}
+
+	for _, c := range secpkCids {
+		var msg types.SignedMessage
+		if err := s.store.Get(ctx, c, &msg); err != nil {
+			return nil, fmt.Errorf("message %s: %w", c, err)
+		}
+
+		msgs.SecpkMessages = append(msgs.SecpkMessages, &msg)
+	}
+
+	return msgs, nil
+}
+
+// ChainGetParentMessages returns the messages executed in the parent tipset of the block bcid, in execution
+// order: the messages of every block in tipset order, without duplicates and skipping the messages whose
+// nonce doesn't follow the previous one of their sender
+func (s *Snapshot) ChainGetParentMessages(ctx context.Context, bcid cid.Cid) ([]types.MessageCID, error) {
+	header, err := s.loadHeader(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []types.MessageCID
+	seen := make(map[cid.Cid]struct{})
+	nonces := make(map[address.Address]uint64)
+	add := func(mcid cid.Cid, msg *types.Message) {
+		if _, ok := seen[mcid]; ok {
+			return
+		}
+		seen[mcid] = struct{}{}
+
+		if _, ok := nonces[msg.From]; !ok {
+			nonces[msg.From] = msg.Nonce
+		}
+		if nonces[msg.From] != msg.Nonce {
+			return
+		}
+		nonces[msg.From]++
+
+		out = append(out, types.MessageCID{Cid: mcid, Message: msg})
+	}
+
+	for _, parent := range header.Parents {
+		msgs, err := s.ChainGetBlockMessages(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs.BlsMessages {
+			add(msg.Cid(), msg)
+		}
+		for _, msg := range msgs.SecpkMessages {
+			add(msg.Cid(), &msg.Message)
+		}
+	}
+
+	return out, nil
+}
+
+// ChainGetParentReceipts returns the receipts of the messages executed in the parent tipset of the block bcid
+func (s *Snapshot) ChainGetParentReceipts(ctx context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error) {
+	header, err := s.loadHeader(bcid)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts, err := amt.LoadAMT(ctx, s.store, header.ParentMessageReceipts)
+	if err != nil {
+		return nil, fmt.Errorf("receipts of block %s: %w", bcid, err)
+	}
+
+	var out []*types.MessageReceipt
+	if err := receipts.ForEach(ctx, func(_ uint64, v *cbg.Deferred) error {
+		var receipt types.MessageReceipt
+		if err := receipt.UnmarshalCBOR(bytes.NewReader(v.Raw)); err != nil {
+			return err
+		}
+
+		out = append(out, &receipt)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("receipts of block %s: %w", bcid, err)
+	}
+
+	return out, nil
+}
+
+// amtCids returns the cids stored in the message AMT root
+func (s *Snapshot) amtCids(ctx context.Context, root cid.Cid) ([]cid.Cid, error) {
+	arr, err := amt.LoadAMT(ctx, s.store, root)
+	if err != nil {
+		return nil, fmt.Errorf("load message AMT %s: %w", root, err)
+	}
+
+	var out []cid.Cid
+	if err := arr.ForEach(ctx, func(_ uint64, v *cbg.Deferred) error {
+		c, err := cbg.ReadCid(cbg.NewCborReader(bytes.NewReader(v.Raw)))
+		if err != nil {
+			return err
+		}
+
+		out = append(out, c)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read message AMT %s: %w", root, err)
+	}
+
+	return out, nil
+}
+
+// ChainNotify is not supported, a snapshot never changes
+func (s *Snapshot) ChainNotify(_ context.Context) (<-chan []*types.HeadChange, error) {
+	return nil, fmt.Errorf("head changes: %w", errNotInSnapshot)
+}
+
+// GetActorEventsRaw is not supported, snapshots don't hold the events of the receipts
+func (s *Snapshot) GetActorEventsRaw(_ context.Context, _ *types.ActorEventFilter) ([]*types.ActorEvent, error) {
+	return nil, fmt.Errorf("actor events: %w", errNotInSnapshot)
+}
+
+// StateGetActor is not supported, the state tree is not read
+func (s *Snapshot) StateGetActor(_ context.Context, addr address.Address, _ types.TipSetKey) (*types.Actor, error) {
+	return nil, fmt.Errorf("actor %s: %w", addr, errNotInSnapshot)
+}
+
+// StateCompute is not supported, tipsets can't be executed without a node
+func (s *Snapshot) StateCompute(_ context.Context, height abi.ChainEpoch, _ []*types.Message, _ types.TipSetKey) (*types.ComputeStateOutput, error) {
+	return nil, fmt.Errorf("execution trace at epoch %d: %w", height, errNotInSnapshot)
+}
+
+// StateListMiners is not supported, the state tree is not read
+func (s *Snapshot) StateListMiners(_ context.Context, _ types.TipSetKey) ([]address.Address, error) {
+	return nil, fmt.Errorf("miners: %w", errNotInSnapshot)
+}
+
+// StateMinerDeadlines is not supported, the state tree is not read
+func (s *Snapshot) StateMinerDeadlines(_ context.Context, maddr address.Address, _ types.TipSetKey) ([]types.Deadline, error) {
+	return nil, fmt.Errorf("deadlines of miner %s: %w", maddr, errNotInSnapshot)
+}
+
+// StateVMCirculatingSupplyInternal is not supported, the state tree is not read
+func (s *Snapshot) StateVMCirculatingSupplyInternal(_ context.Context, _ types.TipSetKey) (types.CirculatingSupply, error) {
+	return types.CirculatingSupply{}, fmt.Errorf("circulating supply: %w", errNotInSnapshot)
+}
+
+// StateMinerPower is not supported, the state tree is not read
+func (s *Snapshot) StateMinerPower(_ context.Context, addr address.Address, _ types.TipSetKey) (*types.MinerPower, error) {
+	return nil, fmt.Errorf("power of miner %s: %w", addr, errNotInSnapshot)
+}
+
+// StateMinerInitialPledgeForSector is not supported, the state tree is not read
+func (s *Snapshot) StateMinerInitialPledgeForSector(_ context.Context, _ abi.ChainEpoch, sectorSize abi.SectorSize, _ uint64, _ types.TipSetKey) (types.BigInt, error) {
+	return types.EmptyInt, fmt.Errorf("initial pledge of a %d bytes sector: %w", sectorSize, errNotInSnapshot)
+}
+
+// ChainReadObj returns the raw block c of the snapshot
+func (s *Snapshot) ChainReadObj(_ context.Context, c cid.Cid) ([]byte, error) {
+	blk, err := s.get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return blk.RawData(), nil
+}
+
+// F3IsRunning always reports false
+func (s *Snapshot) F3IsRunning(_ context.Context) (bool, error) {
+	return false, nil
+}
+
+// F3GetLatestCertificate is not supported
+func (s *Snapshot) F3GetLatestCertificate(_ context.Context) (*certs.FinalityCertificate, error) {
+	return nil, fmt.Errorf("f3 certificate: %w", errNotInSnapshot)
+}
+
+// Close closes the file
+func (s *Snapshot) Close() error {
+	return s.file.Close()
+}
+
+// snapshotBlockstore serves the blocks of a snapshot to the cbor store, it is read-only
+type snapshotBlockstore struct {
+	s *Snapshot
+}
+
+func (b *snapshotBlockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	return b.s.get(c)
+}
+
+func (b *snapshotBlockstore) Put(_ context.Context, _ blocks.Block) error {
+	return errors.New("snapshot is read-only")
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func readCarHeader(r *countingReader) (*car.CarHeader, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read CAR header: %w", err)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("read CAR header: %w", err)
+	}
+
+	var header car.CarHeader
+	if err := cbor.DecodeInto(data, &header); err != nil {
+		return nil, fmt.Errorf("invalid CAR header: %w", err)
+	}
+
+	return &header, nil
+}
+
+// cidKey returns the last 8 bytes of the multihash of c
+func cidKey(c cid.Cid) uint64 {
+	h := c.Hash()
+	if len(h) < 8 {
+		var padded [8]byte
+		copy(padded[8-len(h):], h)
+		return binary.BigEndian.Uint64(padded[:])
+	}
+
+	return binary.BigEndian.Uint64(h[len(h)-8:])
+}
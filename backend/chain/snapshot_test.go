@@ -0,0 +1,103 @@
+package chain_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+// syncRecords syncs every executed epoch of node and describes what the handlers received
+func syncRecords(t *testing.T, node *chain.Node) []string {
+	t.Helper()
+
+	var records []string
+	err := node.SyncBlocks(101, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		records = append(records, fmt.Sprintf("msg %d %d %s %d %d %d", blockMeta.Height, blockMeta.Timestamp, msg.From, msg.Nonce, receipt.ExitCode, receipt.GasUsed))
+		return nil
+	}, chain.WithTipSetHandler(func(meta *chain.TipSetMeta) error {
+		records = append(records, fmt.Sprintf("tipset %d %d %d", meta.Height, meta.Timestamp, len(meta.Key.Cids())))
+		return nil
+	}), chain.WithNullRoundHandler(func(epoch, timestamp int64) error {
+		records = append(records, fmt.Sprintf("null %d %d", epoch, timestamp))
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	secpSender, _ := address.NewIDAddress(200)
+	signed := &types.SignedMessage{
+		Message:   *newMessage(0),
+		Signature: crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: []byte("signature")},
+	}
+	signed.Message.From = secpSender
+
+	failed := newMessage(1)
+	fc.Add(newMessage(0), failed)
+	fc.NullRounds(2)
+	fc.AddTipSet(
+		&types.BlockMessages{BlsMessages: []*types.Message{newMessage(2)}, SecpkMessages: []*types.SignedMessage{signed}},
+		&types.BlockMessages{BlsMessages: []*types.Message{newMessage(2), newMessage(3)}},
+	)
+	fc.Add(newMessage(4))
+	fc.Add()
+	fc.SetReceipt(failed.Cid(), &types.MessageReceipt{ExitCode: exitcode.ErrInsufficientFunds, GasUsed: 10})
+
+	path := filepath.Join(t.TempDir(), "snapshot.car")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fc.WriteCAR(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := chain.OpenSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	head, err := snapshot.ChainHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Height() != 106 {
+		t.Fatalf("expected head at 106, got %d", head.Height())
+	}
+
+	want := syncRecords(t, chain.NewNodeFromSource(ctx, fc))
+	if len(want) != 11 {
+		t.Fatalf("expected 6 messages, 3 tipsets and 2 null rounds, got %v", want)
+	}
+
+	got := syncRecords(t, chain.NewNodeFromSource(ctx, snapshot))
+	if !slices.Equal(want, got) {
+		t.Fatalf("snapshot sync differs from the chain\nwant %v\ngot  %v", want, got)
+	}
+
+	if _, err := snapshot.ChainGetTipSetByHeight(ctx, 99, head.Key()); err == nil {
+		t.Fatal("expected an error below the genesis of the snapshot")
+	}
+}
@@ -0,0 +1,40 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-state-types/abi"
+	v1 "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+)
+
+// ChainSource is the subset of the full node API used by chain synchronization. It is satisfied by
+// v1.FullNode and can be implemented by other sources such as the in-memory chain in chaintest.
+type ChainSource interface {
+	ChainHead(ctx context.Context) (*types.TipSet, error)
+	ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error)
+	ChainGetTipSetAfterHeight(ctx context.Context, height abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error)
+	ChainGetBlockMessages(ctx context.Context, bcid cid.Cid) (*types.BlockMessages, error)
+	ChainGetParentMessages(ctx context.Context, bcid cid.Cid) ([]types.MessageCID, error)
+	ChainGetParentReceipts(ctx context.Context, bcid cid.Cid) ([]*types.MessageReceipt, error)
+	ChainNotify(ctx context.Context) (<-chan []*types.HeadChange, error)
+	ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error)
+
+	GetActorEventsRaw(ctx context.Context, filter *types.ActorEventFilter) ([]*types.ActorEvent, error)
+
+	StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error)
+	StateCompute(ctx context.Context, height abi.ChainEpoch, msgs []*types.Message, tsk types.TipSetKey) (*types.ComputeStateOutput, error)
+	StateListMiners(ctx context.Context, tsk types.TipSetKey) ([]address.Address, error)
+	StateMinerDeadlines(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]types.Deadline, error)
+	StateVMCirculatingSupplyInternal(ctx context.Context, tsk types.TipSetKey) (types.CirculatingSupply, error)
+	StateMinerPower(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.MinerPower, error)
+	StateMinerInitialPledgeForSector(ctx context.Context, sectorDuration abi.ChainEpoch, sectorSize abi.SectorSize, verifiedSize uint64, tsk types.TipSetKey) (types.BigInt, error)
+
+	F3IsRunning(ctx context.Context) (bool, error)
+	F3GetLatestCertificate(ctx context.Context) (*certs.FinalityCertificate, error)
+}
+
+var _ ChainSource = (v1.FullNode)(nil)
@@ -1,42 +1,166 @@
 package chain
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/venus/venus-shared/types"
 	"github.com/ipfs/go-cid"
-	"golang.org/x/sync/errgroup"
 )
 
-const batchBlockNum = 1000
+const (
+	batchBlockNum = 1000
+	// defaultConcurrency is the default number of epochs fetched from the node in parallel
+	defaultConcurrency = 16
+	// blockDelaySecs is the expected interval between two epochs on mainnet
+	blockDelaySecs = 30
+)
 
 // BlockMeta contains base info about a block
 type BlockMeta struct {
 	Height    int64
 	Cid       cid.Cid
 	Timestamp int64
+	// TipSet is the key of the tipset the block belongs to, the state its messages were applied to
+	TipSet types.TipSetKey
+}
+
+// TipSetMeta contains base info about a tipset
+type TipSetMeta struct {
+	Height    int64
+	Key       types.TipSetKey
+	Parents   types.TipSetKey
+	Timestamp int64
+	// Blocks are the headers of the tipset in canonical order, they hold the win counts, parent weight and
+	// timestamps of the blocks
+	Blocks []*types.BlockHeader
+	// ParentBaseFee is the base fee the messages of the tipset paid
+	ParentBaseFee abi.TokenAmount
+	// MessageCount is the number of messages executed for the tipset, a message included in several of its
+	// blocks counts once
+	MessageCount int
+	// GasLimit, GasUsed and Burnt are the totals of the messages executed for the tipset, Burnt is the base
+	// fee and over-estimation burn they paid with the penalty of the block miners, in attoFIL
+	GasLimit int64
+	GasUsed  int64
+	Burnt    abi.TokenAmount
+}
+
+// MsgHandler defines the function type for handling messages during block synchronization, only executed
+// messages are handled and receipt holds their execution result
+type MsgHandler func(blockMeta *BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error
+
+// TipSetHandler defines the function type for handling tipsets during block synchronization
+type TipSetHandler func(tipSetMeta *TipSetMeta) error
+
+// NullRoundHandler defines the function type for handling epochs without any block, the timestamp is
+// the time the epoch would have been mined at
+type NullRoundHandler func(epoch int64, timestamp int64) error
+
+// SyncOption configures optional behaviour of SyncBlocks
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	tipSetHandler    TipSetHandler
+	nullRoundHandler NullRoundHandler
+	callHandler      CallHandler
+	eventHandler     EventHandler
+	trace            bool
+	concurrency      int
+	retries          int
+}
+
+// WithTipSetHandler registers a handler which is called once for every synced tipset
+func WithTipSetHandler(handler TipSetHandler) SyncOption {
+	return func(o *syncOptions) {
+		o.tipSetHandler = handler
+	}
+}
+
+// WithNullRoundHandler registers a handler which is called once for every null round in the synced range
+func WithNullRoundHandler(handler NullRoundHandler) SyncOption {
+	return func(o *syncOptions) {
+		o.nullRoundHandler = handler
+	}
 }
 
-// MsgHandler defines the function type for handling messages during block synchronization
-type MsgHandler func(blockMeta *BlockMeta, msg *types.Message) error
+// WithCallHandler registers a handler which is called for every executed message as a direct call, and
+// for the internal calls it made when tracing is enabled with WithTrace
+func WithCallHandler(handler CallHandler) SyncOption {
+	return func(o *syncOptions) {
+		o.callHandler = handler
+	}
+}
+
+// WithEventHandler registers a handler which is called for every actor event emitted by the executed
+// messages, the node must have its actor events API enabled
+func WithEventHandler(handler EventHandler) SyncOption {
+	return func(o *syncOptions) {
+		o.eventHandler = handler
+	}
+}
+
+// WithTrace replays the execution of every synced tipset so that internal calls are passed to the
+// CallHandler, this is much more expensive for the node than plain syncing
+func WithTrace(trace bool) SyncOption {
+	return func(o *syncOptions) {
+		o.trace = trace
+	}
+}
+
+// WithConcurrency limits the number of epochs fetched from the node in parallel
+func WithConcurrency(concurrency int) SyncOption {
+	return func(o *syncOptions) {
+		if concurrency > 0 {
+			o.concurrency = concurrency
+		}
+	}
+}
+
+// WithRetries sets how many times fetching an epoch is retried after a transient error such as a timeout, a
+// 5xx response or a reset connection before the sync fails, 0 disables retries
+func WithRetries(retries int) SyncOption {
+	return func(o *syncOptions) {
+		if retries >= 0 {
+			o.retries = retries
+		}
+	}
+}
 
-// SyncBlocks synchronizes blocks from startEpoch to endEpoch and processes messages using the provided MsgHandler
-func (n *Node) SyncBlocks(startEpoch, endEpoch int64, msgHandler MsgHandler) error {
+// SyncBlocks synchronizes blocks from startEpoch to endEpoch and processes messages using the provided MsgHandler.
+// Epochs are fetched in parallel but handlers are never called concurrently: they receive epochs in ascending
+// order and the messages of each epoch in their execution order. The head is never synced because its messages
+// have not been executed yet: a zero endEpoch syncs up to the epoch below it, and an endEpoch at or above it fails
+// so that callers never record epochs that were not synced.
+func (n *Node) SyncBlocks(startEpoch, endEpoch int64, msgHandler MsgHandler, opts ...SyncOption) error {
 	if startEpoch < 0 {
 		return errors.New("startEpoch must be greater than 0")
 	}
 
-	headHeight, err := n.ChainHeadHeight()
+	options := &syncOptions{concurrency: defaultConcurrency, retries: defaultRetries}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	head, err := n.ChainHead(n.ctx)
 	if err != nil {
 		return err
 	}
 
+	headHeight := int64(head.Height())
 	slog.Info("chain head height", slog.Int64("height", headHeight))
-	if endEpoch == 0 || endEpoch > headHeight {
-		endEpoch = headHeight
+
+	// messages of the head tipset are not executed yet, so it can't be synced
+	if endEpoch == 0 {
+		endEpoch = headHeight - 1
+	}
+
+	if endEpoch >= headHeight {
+		return fmt.Errorf("endEpoch %d must be below the head %d, its messages are not executed yet", endEpoch, headHeight)
 	}
 
 	if startEpoch > endEpoch {
@@ -45,66 +169,272 @@ func (n *Node) SyncBlocks(startEpoch, endEpoch int64, msgHandler MsgHandler) err
 
 	slog.Info("start syncing", slog.Int64("startEpoch", startEpoch), slog.Int64("endEpoch", endEpoch))
 
+	// all batches are resolved against the same head so that they belong to a single chain
+	anchor := head.Key()
+
 	// batch download blocks
-	for endEpoch-startEpoch > batchBlockNum {
-		slog.Info("syncing batch", slog.Int64("startEpoch", startEpoch), slog.Int64("endEpoch", startEpoch+batchBlockNum))
-		if err := n.syncBatch(startEpoch, startEpoch+batchBlockNum, msgHandler); err != nil {
+	for endEpoch-startEpoch >= batchBlockNum {
+		slog.Info("syncing batch", slog.Int64("startEpoch", startEpoch), slog.Int64("endEpoch", startEpoch+batchBlockNum-1))
+		if err := n.syncBatch(anchor, startEpoch, startEpoch+batchBlockNum-1, msgHandler, options); err != nil {
 			return err
 		}
 
 		startEpoch += batchBlockNum
 	}
 
-	return n.syncBatch(startEpoch, endEpoch, msgHandler)
+	return n.syncBatch(anchor, startEpoch, endEpoch, msgHandler, options)
+}
+
+// epochData holds everything fetched for a single epoch, blockMsgs is aligned with tipset.Blocks()
+// and receipts with executed, traces and events are only set when tracing or events are enabled
+type epochData struct {
+	epoch     int64
+	tipset    *types.TipSet
+	blockMsgs []*types.BlockMessages
+	executed  []types.MessageCID
+	receipts  []*types.MessageReceipt
+	traces    map[cid.Cid]*types.ExecutionTrace
+	events    []*types.ActorEvent
 }
 
-func (n *Node) syncBatch(startEpoch, endEpoch int64, handler MsgHandler) error {
-	g, ctx := errgroup.WithContext(n.ctx)
-	for epoch := startEpoch; epoch <= endEpoch; epoch++ {
-		g.Go(func() error {
-			tipset, err := n.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(epoch), types.TipSetKey{})
-			if err != nil {
-				return fmt.Errorf("failed to get tipset at epoch %d: %w", epoch, err)
+type epochResult struct {
+	data *epochData
+	err  error
+}
+
+// syncBatch fetches the epochs of the batch with at most options.concurrency parallel requests, and
+// delivers them to the handlers one at a time in ascending epoch order
+func (n *Node) syncBatch(anchor types.TipSetKey, startEpoch, endEpoch int64, handler MsgHandler, options *syncOptions) error {
+	ctx, cancel := context.WithCancel(n.ctx)
+	defer cancel()
+
+	results := make([]chan epochResult, endEpoch-startEpoch+1)
+	for idx := range results {
+		results[idx] = make(chan epochResult, 1)
+	}
+
+	go func() {
+		sem := make(chan struct{}, options.concurrency)
+		for idx := range results {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
 
-			seen := make(map[cid.Cid]struct{})
-			for _, blk := range tipset.Blocks() {
-				msgs, err := n.ChainGetBlockMessages(ctx, blk.Cid())
-				if err != nil {
-					return fmt.Errorf("get messages for block %s: %w", blk.Cid(), err)
-				}
+			go func() {
+				defer func() { <-sem }()
 
-				process := func(cmsg cid.Cid, m *types.Message) error {
-					if _, ok := seen[cmsg]; ok {
-						return nil
-					}
-
-					seen[cmsg] = struct{}{}
-					return handler(&BlockMeta{
-						Height:    int64(blk.Height),
-						Cid:       blk.Cid(),
-						Timestamp: int64(blk.Timestamp),
-					}, m)
-				}
+				data, err := n.fetchEpochWithRetry(ctx, anchor, startEpoch+int64(idx), options)
+				results[idx] <- epochResult{data: data, err: err}
+			}()
+		}
+	}()
+
+	for idx := range results {
+		var result epochResult
+		select {
+		case result = <-results[idx]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if result.err != nil {
+			return result.err
+		}
+
+		if err := deliverEpoch(result.data, handler, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchEpoch downloads the tipset at epoch, the messages of all its blocks and their execution results.
+// Messages of a tipset are executed when its child is built, so receipts come from the next non-null tipset.
+func (n *Node) fetchEpoch(ctx context.Context, anchor types.TipSetKey, epoch int64, options *syncOptions) (*epochData, error) {
+	tipset, err := n.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(epoch), anchor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tipset at epoch %d: %w", epoch, err)
+	}
+
+	data := &epochData{epoch: epoch, tipset: tipset}
+
+	// for a null round the node returns the previous non-null tipset, which is synced at its own epoch
+	if int64(tipset.Height()) != epoch {
+		return data, nil
+	}
 
-				for _, m := range msgs.BlsMessages {
-					if err := process(m.Cid(), m); err != nil {
-						return err
-					}
+	for _, blk := range tipset.Blocks() {
+		msgs, err := n.ChainGetBlockMessages(ctx, blk.Cid())
+		if err != nil {
+			return nil, fmt.Errorf("get messages for block %s: %w", blk.Cid(), err)
+		}
+
+		data.blockMsgs = append(data.blockMsgs, msgs)
+	}
+
+	child, err := n.ChainGetTipSetAfterHeight(ctx, tipset.Height()+1, anchor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tipset after epoch %d: %w", epoch, err)
+	}
+
+	if !child.Parents().Equals(tipset.Key()) {
+		return nil, fmt.Errorf("tipset %s at epoch %d is not the parent of %s", tipset.Key(), epoch, child.Key())
+	}
+
+	childBlock := child.Blocks()[0].Cid()
+	if data.executed, err = n.ChainGetParentMessages(ctx, childBlock); err != nil {
+		return nil, fmt.Errorf("get parent messages of block %s: %w", childBlock, err)
+	}
+
+	if data.receipts, err = n.ChainGetParentReceipts(ctx, childBlock); err != nil {
+		return nil, fmt.Errorf("get parent receipts of block %s: %w", childBlock, err)
+	}
+
+	if len(data.executed) != len(data.receipts) {
+		return nil, fmt.Errorf("epoch %d has %d executed messages but %d receipts", epoch, len(data.executed), len(data.receipts))
+	}
+
+	if options.trace && options.callHandler != nil {
+		out, err := n.StateCompute(ctx, tipset.Height(), nil, tipset.Key())
+		if err != nil {
+			return nil, fmt.Errorf("compute state of tipset at epoch %d: %w", epoch, err)
+		}
+
+		// the output also traces implicit messages such as cron, which are not indexed
+		data.traces = make(map[cid.Cid]*types.ExecutionTrace, len(out.Trace))
+		for _, res := range out.Trace {
+			data.traces[res.MsgCid] = &res.ExecutionTrace
+		}
+	}
+
+	if options.eventHandler != nil {
+		key := tipset.Key()
+		if data.events, err = n.GetActorEventsRaw(ctx, &types.ActorEventFilter{TipSetKey: &key}); err != nil {
+			return nil, fmt.Errorf("get actor events of tipset at epoch %d: %w", epoch, err)
+		}
+	}
+
+	return data, nil
+}
+
+// deliverEpoch calls the handlers for an epoch, messages are delivered in their execution order
+// together with their receipt and the first block that included them
+func deliverEpoch(data *epochData, handler MsgHandler, options *syncOptions) error {
+	tipset := data.tipset
+	if int64(tipset.Height()) != data.epoch {
+		if options.nullRoundHandler == nil {
+			return nil
+		}
+
+		timestamp := int64(tipset.MinTimestamp()) + (data.epoch-int64(tipset.Height()))*blockDelaySecs
+		return options.nullRoundHandler(data.epoch, timestamp)
+	}
+
+	if options.tipSetHandler != nil {
+		tipSetMeta := &TipSetMeta{
+			Height:        int64(tipset.Height()),
+			Key:           tipset.Key(),
+			Parents:       tipset.Parents(),
+			Timestamp:     int64(tipset.MinTimestamp()),
+			Blocks:        tipset.Blocks(),
+			ParentBaseFee: tipset.Blocks()[0].ParentBaseFee,
+			MessageCount:  len(data.executed),
+			Burnt:         big.Zero(),
+		}
+		for idx, m := range data.executed {
+			tipSetMeta.GasLimit += m.Message.GasLimit
+			tipSetMeta.GasUsed += data.receipts[idx].GasUsed
+			tipSetMeta.Burnt = big.Add(tipSetMeta.Burnt, ComputeGasOutputs(m.Message, data.receipts[idx], tipSetMeta.ParentBaseFee).Burned())
+		}
+
+		if err := options.tipSetHandler(tipSetMeta); err != nil {
+			return err
+		}
+	}
+
+	includedIn := make(map[cid.Cid]*types.BlockHeader)
+	for idx, blk := range tipset.Blocks() {
+		for _, mcid := range data.blockMsgs[idx].Cids {
+			if _, ok := includedIn[mcid]; !ok {
+				includedIn[mcid] = blk
+			}
+		}
+	}
+
+	// events are grouped by message, keeping their order
+	events := make(map[cid.Cid][]*Event)
+	var eventMsgs []cid.Cid
+	for _, e := range data.events {
+		if e.Reverted {
+			continue
+		}
+
+		if _, ok := events[e.MsgCid]; !ok {
+			eventMsgs = append(eventMsgs, e.MsgCid)
+		}
+		events[e.MsgCid] = append(events[e.MsgCid], &Event{
+			MsgCid:  e.MsgCid,
+			Index:   len(events[e.MsgCid]),
+			Emitter: e.Emitter,
+			Entries: e.Entries,
+		})
+	}
+
+	for idx, m := range data.executed {
+		blk, ok := includedIn[m.Cid]
+		if !ok {
+			return fmt.Errorf("executed message %s not found in tipset %s", m.Cid, tipset.Key())
+		}
+
+		blockMeta := &BlockMeta{
+			Height:    int64(blk.Height),
+			Cid:       blk.Cid(),
+			Timestamp: int64(blk.Timestamp),
+			TipSet:    tipset.Key(),
+		}
+		if handler != nil {
+			if err := handler(blockMeta, m.Message, data.receipts[idx]); err != nil {
+				return err
+			}
+		}
+
+		if options.callHandler != nil {
+			calls := []*Call{directCall(m.Message.Cid(), m.Message, data.receipts[idx])}
+			if data.traces != nil {
+				trace, ok := data.traces[m.Cid]
+				if !ok {
+					return fmt.Errorf("no execution trace for message %s", m.Cid)
 				}
-				for _, sm := range msgs.SecpkMessages {
-					if err := process(sm.Cid(), &sm.Message); err != nil {
-						return err
-					}
+
+				calls = traceCalls(m.Message.Cid(), trace)
+			}
+
+			for _, call := range calls {
+				if err := options.callHandler(blockMeta, call); err != nil {
+					return err
 				}
 			}
-			return nil
-		})
+		}
+
+		for _, event := range events[m.Cid] {
+			if err := options.eventHandler(blockMeta, event); err != nil {
+				return err
+			}
+		}
+		delete(events, m.Cid)
 	}
 
-	// Wait for all goroutines to complete and return any error
-	if err := g.Wait(); err != nil {
-		return err
+	// what is left was emitted by implicit messages
+	implicit := &BlockMeta{Height: int64(tipset.Height()), Timestamp: int64(tipset.MinTimestamp()), TipSet: tipset.Key()}
+	for _, mcid := range eventMsgs {
+		for _, event := range events[mcid] {
+			if err := options.eventHandler(implicit, event); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
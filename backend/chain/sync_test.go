@@ -0,0 +1,330 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+var _ chain.ChainSource = (*chaintest.Chain)(nil)
+
+func newMessage(nonce uint64) *types.Message {
+	from, _ := address.NewIDAddress(100)
+	return &types.Message{
+		From:       from,
+		To:         builtin.StoragePowerActorAddr,
+		Nonce:      nonce,
+		Value:      abi.NewTokenAmount(0),
+		GasLimit:   1000,
+		GasFeeCap:  abi.NewTokenAmount(1),
+		GasPremium: abi.NewTokenAmount(1),
+		Method:     builtin.MethodsPower.CreateMiner,
+	}
+}
+
+func TestSyncBlocksOrder(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	dup := newMessage(2)
+	fc.Add(newMessage(0), newMessage(1))
+	fc.AddTipSet(
+		&types.BlockMessages{BlsMessages: []*types.Message{dup, newMessage(3)}},
+		&types.BlockMessages{BlsMessages: []*types.Message{dup, newMessage(4)}},
+	)
+	for nonce := uint64(5); nonce < 50; nonce++ {
+		fc.Add(newMessage(nonce))
+	}
+	// the head is never synced as its messages are not executed yet
+	fc.Add(newMessage(50))
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	var nonces []uint64
+	var lastHeight int64
+	var tipsets int
+	err := node.SyncBlocks(101, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		if blockMeta.Height < lastHeight {
+			t.Fatalf("epoch %d delivered after %d", blockMeta.Height, lastHeight)
+		}
+		lastHeight = blockMeta.Height
+		nonces = append(nonces, msg.Nonce)
+		return nil
+	}, chain.WithConcurrency(4), chain.WithTipSetHandler(func(*chain.TipSetMeta) error {
+		tipsets++
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tipsets != 47 {
+		t.Fatalf("expected 47 tipsets, got %d", tipsets)
+	}
+
+	// the two blocks of the second tipset are delivered in canonical order, so only check the rest
+	if len(nonces) != 50 {
+		t.Fatalf("expected 50 messages, got %d: %v", len(nonces), nonces)
+	}
+	for idx, nonce := range nonces {
+		if idx < 2 || idx > 4 {
+			if nonce != uint64(idx) {
+				t.Fatalf("message %d delivered at position %d", nonce, idx)
+			}
+		}
+	}
+}
+
+func TestSyncBlocksNullRounds(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	fc.Add(newMessage(0))
+	fc.NullRounds(2)
+	fc.Add(newMessage(1))
+	fc.Add(newMessage(2))
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	var heights []int64
+	var nullRounds []int64
+	err := node.SyncBlocks(101, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		heights = append(heights, blockMeta.Height)
+		return nil
+	}, chain.WithNullRoundHandler(func(epoch, timestamp int64) error {
+		if timestamp != chaintest.GenesisTimestamp+epoch*30 {
+			t.Fatalf("unexpected timestamp %d for null round %d", timestamp, epoch)
+		}
+		nullRounds = append(nullRounds, epoch)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(heights) != 3 || heights[0] != 101 || heights[1] != 104 || heights[2] != 105 {
+		t.Fatalf("unexpected message heights %v", heights)
+	}
+	if len(nullRounds) != 2 || nullRounds[0] != 102 || nullRounds[1] != 103 {
+		t.Fatalf("unexpected null rounds %v", nullRounds)
+	}
+}
+
+func TestSyncBlocksBatchBoundary(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(0)
+	for nonce := uint64(0); nonce < 2500; nonce++ {
+		fc.Add(newMessage(nonce))
+	}
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	seen := make(map[int64]struct{})
+	err := node.SyncBlocks(1, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		if _, ok := seen[blockMeta.Height]; ok {
+			t.Fatalf("epoch %d delivered twice", blockMeta.Height)
+		}
+		seen[blockMeta.Height] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 2500 {
+		t.Fatalf("expected 2500 epochs, got %d", len(seen))
+	}
+}
+
+func TestSyncBlocksReceipts(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	failed := newMessage(1)
+	fc.SetReceipt(failed.Cid(), &types.MessageReceipt{ExitCode: exitcode.SysErrOutOfGas, GasUsed: 1000})
+	fc.Add(newMessage(0), failed)
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	exitCodes := make(map[uint64]exitcode.ExitCode)
+	err := node.SyncBlocks(101, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		exitCodes[msg.Nonce] = receipt.ExitCode
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exitCodes) != 2 || exitCodes[0] != exitcode.Ok || exitCodes[1] != exitcode.SysErrOutOfGas {
+		t.Fatalf("unexpected exit codes %v", exitCodes)
+	}
+
+	var tipSetMeta *chain.TipSetMeta
+	err = node.SyncBlocks(101, 0, nil, chain.WithTipSetHandler(func(meta *chain.TipSetMeta) error {
+		tipSetMeta = meta
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both messages use their whole gas limit, the base fee of 100 is capped by their fee cap of 1 and the
+	// block miner is penalized the rest
+	if tipSetMeta.GasLimit != 2000 || tipSetMeta.GasUsed != 2000 || tipSetMeta.Burnt.String() != "200000" {
+		t.Fatalf("unexpected totals %+v", tipSetMeta)
+	}
+}
+
+func TestSyncBlocksTrace(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	multisig, _ := address.NewIDAddress(200)
+	propose := newMessage(0)
+	propose.To = multisig
+	propose.Method = builtin.MethodsMultisig.Propose
+	fc.SetSubcalls(propose.Cid(), types.ExecutionTrace{
+		Msg: types.MessageTrace{
+			From:   multisig,
+			To:     builtin.StoragePowerActorAddr,
+			Value:  abi.NewTokenAmount(0),
+			Method: builtin.MethodsPower.CreateMiner,
+		},
+	})
+	fc.Add(propose, newMessage(1))
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	for _, trace := range []bool{false, true} {
+		var calls []*chain.Call
+		err := node.SyncBlocks(101, 0, nil, chain.WithTrace(trace), chain.WithCallHandler(func(blockMeta *chain.BlockMeta, call *chain.Call) error {
+			calls = append(calls, call)
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !trace {
+			if len(calls) != 2 || calls[0].Internal || calls[1].Internal {
+				t.Fatalf("expected 2 direct calls without tracing, got %+v", calls)
+			}
+			continue
+		}
+
+		if len(calls) != 3 {
+			t.Fatalf("expected 3 calls with tracing, got %d", len(calls))
+		}
+
+		internal := calls[1]
+		if !internal.Internal || internal.Depth != 1 || internal.Index != 1 || internal.Parent != calls[0] {
+			t.Fatalf("unexpected internal call %+v", internal)
+		}
+		if internal.MsgCid != propose.Cid() || internal.From != multisig || internal.Method != builtin.MethodsPower.CreateMiner {
+			t.Fatalf("unexpected internal call %+v", internal)
+		}
+		if calls[2].Internal || calls[2].Index != 0 {
+			t.Fatalf("unexpected direct call %+v", calls[2])
+		}
+	}
+}
+
+func TestSyncBlocksEvents(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	topic := make([]byte, 32)
+	topic[31] = 1
+	log := newMessage(0)
+	fc.SetEvents(log.Cid(),
+		types.Event{Emitter: 1000, Entries: []types.EventEntry{
+			{Flags: types.EventFlagIndexedKey | types.EventFlagIndexedValue, Key: "t1", Codec: 0x55, Value: topic},
+			{Flags: types.EventFlagIndexedKey | types.EventFlagIndexedValue, Key: "d", Codec: 0x55, Value: []byte("data")},
+		}},
+		// CBOR text string "sector-activated"
+		types.Event{Emitter: 2000, Entries: []types.EventEntry{
+			{Flags: types.EventFlagIndexedKey | types.EventFlagIndexedValue, Key: "$type", Codec: 0x51, Value: append([]byte{0x70}, "sector-activated"...)},
+		}},
+	)
+	fc.Add(newMessage(1), log)
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	var order []string
+	var events []*chain.Event
+	err := node.SyncBlocks(101, 0, func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+		order = append(order, "msg")
+		return nil
+	}, chain.WithEventHandler(func(blockMeta *chain.BlockMeta, event *chain.Event) error {
+		if blockMeta.Height != 101 {
+			t.Fatalf("unexpected event height %d", blockMeta.Height)
+		}
+		order = append(order, "event")
+		events = append(events, event)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// events follow the message that emitted them
+	if !slices.Equal(order, []string{"msg", "msg", "event", "event"}) {
+		t.Fatalf("unexpected delivery order %v", order)
+	}
+
+	evmLog, builtinEvent := events[0], events[1]
+	if evmLog.MsgCid != log.Cid() || evmLog.Index != 0 || evmLog.Emitter.String() != "f01000" {
+		t.Fatalf("unexpected log %+v", evmLog)
+	}
+	if topics := evmLog.Topics(); len(topics) != 1 || !bytes.Equal(topics[0], topic) || string(evmLog.Data()) != "data" || evmLog.Type() != "" {
+		t.Fatalf("unexpected log topics %x or data %q", topics, evmLog.Data())
+	}
+	if builtinEvent.Index != 1 || builtinEvent.Type() != "sector-activated" || len(builtinEvent.Topics()) != 0 {
+		t.Fatalf("unexpected built-in event %+v", builtinEvent)
+	}
+}
+
+func TestSyncBlocksHead(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	var heights []int64
+	tipSetHandler := chain.WithTipSetHandler(func(tipSetMeta *chain.TipSetMeta) error {
+		heights = append(heights, tipSetMeta.Height)
+		return nil
+	})
+
+	// the messages of the head at 102 are not executed yet
+	if err := node.SyncBlocks(101, 102, nil, tipSetHandler); err == nil {
+		t.Fatal("expected syncing the head to fail")
+	}
+	if len(heights) != 0 {
+		t.Fatalf("expected nothing to be synced, got %v", heights)
+	}
+
+	if err := node.SyncBlocks(101, 0, nil, tipSetHandler); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 1 || heights[0] != 101 {
+		t.Fatalf("expected a zero end to sync up to the epoch below the head, got %v", heights)
+	}
+}
@@ -2,15 +2,15 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
-	"github.com/filecoin-project/go-state-types/builtin"
-	"github.com/filecoin-project/venus/venus-shared/actors/types"
 	"github.com/urfave/cli/v3"
 
 	"github.com/ipfs-force-community/janus/chain"
@@ -37,15 +37,50 @@ func main() {
 				Value:   "http://127.0.0.1:3463",
 			},
 			&cli.StringFlag{
-				Name:     "node-token",
-				Usage:    "Filecoin node endpoint token",
-				Required: true,
+				Name:  "node-token",
+				Usage: "Filecoin node endpoint token",
 			},
 			&cli.Int64Flag{
 				Name:  "interval",
 				Usage: "Interval in seconds between indexing runs",
 				Value: 10,
 			},
+			&cli.Int64Flag{
+				Name:  "confirm-depth",
+				Usage: "Number of epochs to stay behind the chain head when F3 finality is unavailable",
+				Value: 20,
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "Maximum number of epochs fetched from the node in parallel",
+				Value: 16,
+			},
+			&cli.BoolFlag{
+				Name:  "live",
+				Usage: "Sync on head changes pushed by the node, polling every --interval only while the subscription is down",
+			},
+			&cli.IntFlag{
+				Name:  "retries",
+				Usage: "Number of times fetching an epoch is retried after a transient error such as a timeout or a reset connection",
+				Value: 5,
+			},
+			&cli.BoolFlag{
+				Name:  "trace",
+				Usage: "Replay tipset execution to also index CreateMiner calls made by multisigs and contracts, this is expensive for the node",
+			},
+			&cli.Int64Flag{
+				Name:  "repair-interval",
+				Usage: "Interval in seconds between two searches for epochs the handlers never processed, which are then synced again, 0 disables it",
+				Value: 600,
+			},
+			&cli.StringSliceFlag{
+				Name:  "reset-handler",
+				Usage: "Delete the rows and checkpoint of the named handler before starting so that it syncs again from the start, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "metrics-listen",
+				Usage: "Address to serve metrics such as the node pool state on at /debug/vars, disabled when empty",
+			},
 		},
 		Action: action,
 	}
@@ -68,38 +103,65 @@ func action(ctx context.Context, c *cli.Command) error {
 		return err
 	}
 
-	if err := db.AutoMigrate(&orm.Miner{}, &orm.Chain{}); err != nil {
+	if err := orm.AutoMigrate(db, &orm.Miner{}, &orm.Chain{}, &orm.Checkpoint{}, &orm.SyncedRange{}, &orm.TipSet{}, &orm.NullRound{}, &orm.ActorEvent{}, &orm.ChainStat{}, &orm.SectorMessage{}, &orm.FeeSample{}, &orm.PledgeSample{}, &orm.MessageTermination{}, &orm.PowerSample{}, &orm.MinerPower{}); err != nil {
+		return err
+	}
+
+	indexerConfig := struct {
+		Nodes    chain.PoolConfig        `yaml:"nodes"`
+		Handlers []indexer.HandlerConfig `yaml:"handlers"`
+	}{}
+	if err := mysql.Load(configPath, &indexerConfig); err != nil {
+		return err
+	}
+
+	handlers, err := indexer.NewHandlers(indexerConfig.Handlers)
+	if err != nil {
 		return err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	node, err := chain.NewNode(ctx, c.String("node-endpoint"), c.String("node-token"))
+
+	// the node pool from the config file takes precedence over the single endpoint flags
+	var node *chain.Node
+	if len(indexerConfig.Nodes.Endpoints) > 0 {
+		node, err = chain.NewPoolNode(ctx, indexerConfig.Nodes)
+	} else {
+		node, err = chain.NewNode(ctx, c.String("node-endpoint"), c.String("node-token"))
+	}
 	if err != nil {
 		return err
 	}
 
-	createMinerMsgHandler := func(blockMeta *chain.BlockMeta, msg *types.Message) error {
-		if msg.To == builtin.StoragePowerActorAddr && msg.Method == builtin.MethodsPower.CreateMiner {
-			if err := db.Create(&orm.Miner{
-				Height:    blockMeta.Height,
-				Cid:       blockMeta.Cid.String(),
-				Timestamp: blockMeta.Timestamp,
-				MsgCid:    msg.Cid().String(),
-				From:      msg.From.String(),
-				Cost:      msg.Value.String(),
-			}).Error; err != nil {
-				return err
+	if addr := c.String("metrics-listen"); addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, expvar.Handler()); err != nil {
+				slog.Error("metrics server error", "error", err)
 			}
-		}
-
-		return nil
+		}()
 	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 
-	indexer := indexer.NewIndexer(ctx, c.Int64("interval"), node, db, createMinerMsgHandler)
+	indexer := indexer.NewIndexer(ctx, indexer.Options{
+		Interval:       c.Int64("interval"),
+		ConfirmDepth:   c.Int64("confirm-depth"),
+		Concurrency:    c.Int("concurrency"),
+		Retries:        c.Int("retries"),
+		Trace:          c.Bool("trace"),
+		Live:           c.Bool("live"),
+		RepairInterval: c.Int64("repair-interval"),
+	}, node, db, handlers...)
+
+	for _, name := range c.StringSlice("reset-handler") {
+		slog.Info("resetting handler", "handler", name)
+		if err := indexer.ResetHandler(name); err != nil {
+			return err
+		}
+	}
+
 	go func() {
 		defer wg.Done()
 		indexer.Start()
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/indexer"
+)
+
+var gaps = &cli.Command{
+	Name:  "gaps",
+	Usage: "List the ranges of epochs below their checkpoint that the handlers never processed",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "handler",
+			Usage: "Name of the handler to check, can be repeated, all handlers are checked when not set",
+		},
+	},
+	Action: gapsAction,
+}
+
+func gapsAction(ctx context.Context, c *cli.Command) error {
+	db := ctx.Value(contextKey("db")).(*gorm.DB)
+
+	// gaps are computed from the database alone, no node is needed
+	handlers := ctx.Value(contextKey("handlers")).([]*indexer.Handler)
+	idx := indexer.NewIndexer(ctx, indexer.Options{}, nil, db, handlers...)
+
+	names := c.StringSlice("handler")
+	if len(names) == 0 {
+		for _, handler := range handlers {
+			names = append(names, handler.Name)
+		}
+	}
+
+	for _, name := range names {
+		ranges, err := idx.Gaps(name)
+		if err != nil {
+			return err
+		}
+
+		if len(ranges) == 0 {
+			fmt.Printf("%s: no gap\n", name)
+			continue
+		}
+
+		for _, r := range ranges {
+			fmt.Printf("%s: %d-%d (%d epochs)\n", name, r.From, r.To, r.To-r.From+1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/indexer"
+)
+
+var importCAR = &cli.Command{
+	Name:  "import",
+	Usage: "Index the epochs of a Filecoin snapshot CAR file without any node, replacing the rows already indexed in the range",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "car",
+			Usage:    "Snapshot `FILE`, a .car.zst snapshot must be decompressed first",
+			Required: true,
+		},
+		&cli.Int64Flag{
+			Name:     "from",
+			Usage:    "First epoch to import, the snapshot must hold the messages of the epoch and its receipts",
+			Required: true,
+		},
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "Last epoch to import, 0 means up to the head of the snapshot",
+		},
+		&cli.StringSliceFlag{
+			Name:  "handler",
+			Usage: "Name of the handler to run, can be repeated, all handlers are run when not set",
+		},
+	},
+	Action: importAction,
+}
+
+func importAction(ctx context.Context, c *cli.Command) error {
+	if c.Bool("trace") {
+		return errors.New("--trace needs a node to replay the tipsets, it can't be used with a snapshot")
+	}
+
+	snapshot, err := chain.OpenSnapshot(c.String("car"))
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	db := ctx.Value(contextKey("db")).(*gorm.DB)
+	handlers := ctx.Value(contextKey("handlers")).([]*indexer.Handler)
+
+	// snapshots don't hold actor events nor the state, handlers that need them only run when asked for and then
+	// fail on the first lookup
+	names := c.StringSlice("handler")
+	if len(names) == 0 {
+		for _, handler := range handlers {
+			if handler.Event != nil {
+				slog.Warn("skipping handler of actor events, they are not in snapshots", slog.String("handler", handler.Name))
+				continue
+			}
+			if handler.Sample != nil {
+				slog.Warn("skipping sampling handler, snapshots don't hold the state", slog.String("handler", handler.Name))
+				continue
+			}
+			if handler.NeedsTrace {
+				slog.Warn("skipping handler of traced calls, snapshots can't be traced", slog.String("handler", handler.Name))
+				continue
+			}
+			if len(handler.Filter.Actors) > 0 || len(handler.Filter.FromActors) > 0 {
+				slog.Warn("skipping handler filtered by actor, snapshots don't hold the state", slog.String("handler", handler.Name))
+				continue
+			}
+			names = append(names, handler.Name)
+		}
+
+		if len(names) == 0 {
+			return errors.New("no handler to import")
+		}
+	}
+
+	// reading the file never fails transiently, so nothing is retried
+	idx := indexer.NewIndexer(ctx, indexer.Options{
+		Concurrency: c.Int("concurrency"),
+	}, chain.NewNodeFromSource(ctx, snapshot), db, handlers...)
+
+	return idx.Reindex(c.Int64("from"), c.Int64("to"), names...)
+}
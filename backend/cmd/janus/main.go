@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/ipfs-force-community/janus/chain"
 	"github.com/ipfs-force-community/janus/database/mysql"
 	"github.com/ipfs-force-community/janus/database/orm"
+	"github.com/ipfs-force-community/janus/indexer"
 )
 
 type contextKey string
@@ -32,9 +34,8 @@ func main() {
 				Value:   "http://127.0.0.1:3463",
 			},
 			&cli.StringFlag{
-				Name:     "node-token",
-				Usage:    "Filecoin node endpoint token",
-				Required: true,
+				Name:  "node-token",
+				Usage: "Filecoin node endpoint token, required by the commands that read from the node",
 			},
 			&cli.Int64Flag{
 				Name:  "start-epoch",
@@ -46,6 +47,20 @@ func main() {
 				Usage: "End epoch to sync to, 0 means sync to the latest",
 				Value: 0,
 			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "Maximum number of epochs fetched from the node in parallel",
+				Value: 16,
+			},
+			&cli.IntFlag{
+				Name:  "retries",
+				Usage: "Number of times fetching an epoch is retried after a transient error such as a timeout or a reset connection",
+				Value: 5,
+			},
+			&cli.BoolFlag{
+				Name:  "trace",
+				Usage: "Replay tipset execution to also index CreateMiner calls made by multisigs and contracts, this is expensive for the node",
+			},
 		},
 		Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
 			configPath := c.String("config")
@@ -60,22 +75,33 @@ func main() {
 				return ctx, err
 			}
 
-			if err := db.AutoMigrate(&orm.Miner{}); err != nil {
+			if err := orm.AutoMigrate(db, &orm.Miner{}, &orm.Checkpoint{}, &orm.SyncedRange{}, &orm.ActorEvent{}, &orm.ChainStat{}, &orm.SectorMessage{}, &orm.FeeSample{}, &orm.PledgeSample{}, &orm.MessageTermination{}, &orm.PowerSample{}, &orm.MinerPower{}); err != nil {
 				return ctx, err
 			}
 
 			ctx = context.WithValue(ctx, contextKey("db"), db)
 
-			node, err := chain.NewNode(ctx, c.String("node-endpoint"), c.String("node-token"))
+			handlerConfig := struct {
+				Handlers []indexer.HandlerConfig `yaml:"handlers"`
+			}{}
+			if err := mysql.Load(configPath, &handlerConfig); err != nil {
+				return ctx, err
+			}
+
+			handlers, err := indexer.NewHandlers(handlerConfig.Handlers)
 			if err != nil {
 				return ctx, err
 			}
 
-			ctx = context.WithValue(ctx, contextKey("node_endpoint"), node)
+			ctx = context.WithValue(ctx, contextKey("handlers"), handlers)
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
 			miner,
+			reindex,
+			gaps,
+			importCAR,
+			record,
 		},
 
 		Action: func(ctx context.Context, c *cli.Command) error {
@@ -87,3 +113,12 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// newNode connects to the node set by the root flags, commands that don't read from the node never call it
+func newNode(ctx context.Context, c *cli.Command) (*chain.Node, error) {
+	if c.String("node-token") == "" {
+		return nil, fmt.Errorf("--node-token is required by %s", c.Name)
+	}
+
+	return chain.NewNode(ctx, c.String("node-endpoint"), c.String("node-token"))
+}
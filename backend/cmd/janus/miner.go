@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 
-	"github.com/filecoin-project/go-state-types/builtin"
-	"github.com/filecoin-project/venus/venus-shared/actors/types"
 	"github.com/urfave/cli/v3"
 	"gorm.io/gorm"
 
-	"github.com/ipfs-force-community/janus/chain"
 	"github.com/ipfs-force-community/janus/database/orm"
+	"github.com/ipfs-force-community/janus/indexer"
 )
 
 var miner = &cli.Command{
@@ -21,24 +20,35 @@ var miner = &cli.Command{
 }
 
 func minerAction(ctx context.Context, c *cli.Command) error {
-	node := ctx.Value(contextKey("node_endpoint")).(*chain.Node)
-	db := ctx.Value(contextKey("db")).(*gorm.DB)
+	node, err := newNode(ctx, c)
+	if err != nil {
+		return err
+	}
 
-	if err := node.SyncBlocks(c.Int64("start-epoch"), c.Int64("end-epoch"), func(blockMeta *chain.BlockMeta, msg *types.Message) error {
-		if msg.To == builtin.StoragePowerActorAddr && msg.Method == builtin.MethodsPower.CreateMiner {
-			if err := db.Create(&orm.Miner{
-				Height:    blockMeta.Height,
-				Cid:       blockMeta.Cid.String(),
-				Timestamp: blockMeta.Timestamp,
-				MsgCid:    msg.Cid().String(),
-				From:      msg.From.String(),
-			}).Error; err != nil {
-				return err
+	db := ctx.Value(contextKey("db")).(*gorm.DB)
+	handlers := ctx.Value(contextKey("handlers")).([]*indexer.Handler)
+
+	// the configured handlers writing the miners table
+	var names []string
+	for _, handler := range handlers {
+		for _, model := range handler.Models {
+			if _, ok := model.(*orm.Miner); ok {
+				names = append(names, handler.Name)
+				break
 			}
 		}
+	}
+	if len(names) == 0 {
+		return errors.New("no configured handler indexes miners")
+	}
 
-		return nil
-	}); err != nil {
+	// miners already indexed in the range are replaced, so overlapping runs are harmless
+	idx := indexer.NewIndexer(ctx, indexer.Options{
+		Concurrency: c.Int("concurrency"),
+		Retries:     c.Int("retries"),
+		Trace:       c.Bool("trace"),
+	}, node, db, handlers...)
+	if err := idx.Reindex(c.Int64("start-epoch"), c.Int64("end-epoch"), names...); err != nil {
 		slog.Error("SyncBlocks error", "error", err)
 	}
 
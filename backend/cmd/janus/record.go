@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/indexer"
+)
+
+var record = &cli.Command{
+	Name:  "record",
+	Usage: "Run the handlers over a range of epochs and save every request made to the node with its response, to be replayed in tests",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "out",
+			Usage:    "Write the recording to `FILE`, one JSON-RPC request and response per line",
+			Required: true,
+		},
+		&cli.Int64Flag{
+			Name:     "from",
+			Usage:    "First epoch to record",
+			Required: true,
+		},
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "Last epoch to record, 0 means up to the latest",
+		},
+		&cli.StringSliceFlag{
+			Name:  "handler",
+			Usage: "Name of the handler to run, can be repeated, all handlers are run when not set",
+		},
+		&cli.BoolFlag{
+			Name:  "write",
+			Usage: "Replace the rows indexed in the range like reindex, they are discarded otherwise",
+		},
+	},
+	Action: recordAction,
+}
+
+func recordAction(ctx context.Context, c *cli.Command) error {
+	node, err := newNode(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	file, err := os.Create(c.String("out"))
+	if err != nil {
+		return err
+	}
+
+	db := ctx.Value(contextKey("db")).(*gorm.DB)
+	handlers := ctx.Value(contextKey("handlers")).([]*indexer.Handler)
+
+	recorder := chain.NewRecorder(node, file)
+	idx := indexer.NewIndexer(ctx, indexer.Options{
+		Concurrency: c.Int("concurrency"),
+		Retries:     c.Int("retries"),
+		Trace:       c.Bool("trace"),
+		DryRun:      !c.Bool("write"),
+	}, chain.NewNodeFromSource(ctx, recorder), db, handlers...)
+
+	// whatever was recorded is kept, even when the range failed
+	err = idx.Reindex(c.Int64("from"), c.Int64("to"), c.StringSlice("handler")...)
+	return errors.Join(err, recorder.Flush(), file.Close())
+}
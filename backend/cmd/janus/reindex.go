@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/indexer"
+)
+
+var reindex = &cli.Command{
+	Name:  "reindex",
+	Usage: "Delete the rows indexed between two epochs and rebuild them, without touching the indexer checkpoints",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:     "from",
+			Usage:    "First epoch to reindex",
+			Required: true,
+		},
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "Last epoch to reindex, 0 means up to the latest",
+		},
+		&cli.StringSliceFlag{
+			Name:  "handler",
+			Usage: "Name of the handler to reindex, can be repeated, all handlers are reindexed when not set",
+		},
+	},
+	Action: reindexAction,
+}
+
+func reindexAction(ctx context.Context, c *cli.Command) error {
+	node, err := newNode(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.Value(contextKey("db")).(*gorm.DB)
+	handlers := ctx.Value(contextKey("handlers")).([]*indexer.Handler)
+
+	idx := indexer.NewIndexer(ctx, indexer.Options{
+		Concurrency: c.Int("concurrency"),
+		Retries:     c.Int("retries"),
+		Trace:       c.Bool("trace"),
+	}, node, db, handlers...)
+
+	return idx.Reindex(c.Int64("from"), c.Int64("to"), c.StringSlice("handler")...)
+}
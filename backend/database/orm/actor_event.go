@@ -0,0 +1,27 @@
+package orm
+
+import "gorm.io/gorm"
+
+// ActorEvent represents table actor_events in the database, a row is an event emitted while executing a
+// message: a log of an EVM contract, with its topics and data, or an event of a built-in actor, with its
+// type and fields
+type ActorEvent struct {
+	gorm.Model
+	Height     int64  `gorm:"not null;index"`
+	Timestamp  int64  `gorm:"not null"`
+	Cid        string `gorm:"type:varchar(255);column:cid"`
+	MsgCid     string `gorm:"type:varchar(255);column:msg_cid;uniqueIndex:idx_actor_events_msg_event;not null"`
+	EventIndex int    `gorm:"not null;default:0;uniqueIndex:idx_actor_events_msg_event"`
+	Emitter    string `gorm:"type:varchar(255);not null;index"`
+
+	// built-in actor events, Fields holds the entries other than $type as a JSON object
+	Type   string `gorm:"type:varchar(64);index"`
+	Fields string `gorm:"type:text"`
+
+	// EVM logs, topics and data are 0x prefixed hex
+	Topic1 string `gorm:"type:varchar(66);index"`
+	Topic2 string `gorm:"type:varchar(66)"`
+	Topic3 string `gorm:"type:varchar(66)"`
+	Topic4 string `gorm:"type:varchar(66)"`
+	Data   string `gorm:"type:mediumtext"`
+}
@@ -2,7 +2,10 @@ package orm
 
 import "gorm.io/gorm"
 
-// Chain represents table chain in the database
+// Chain represents table chain in the database.
+//
+// Deprecated: the indexer keeps one Checkpoint per handler, the row with id 1 is only read once to
+// initialize the checkpoints of a database indexed before they existed.
 type Chain struct {
 	gorm.Model
 	Height int64 `gorm:"not null"`
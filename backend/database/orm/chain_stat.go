@@ -0,0 +1,21 @@
+package orm
+
+import "gorm.io/gorm"
+
+// ChainStat represents table chain_stats in the database, a row describes one tipset, epochs without one
+// are in null_rounds. Amounts are in attoFIL.
+type ChainStat struct {
+	gorm.Model
+	Height        int64  `gorm:"not null;uniqueIndex"`
+	Timestamp     int64  `gorm:"not null;index"`
+	Blocks        int    `gorm:"not null"`
+	WinCount      int64  `gorm:"not null"`
+	ParentWeight  string `gorm:"type:varchar(255);not null"`
+	ParentBaseFee string `gorm:"type:varchar(255);not null"`
+	MessageCount  int    `gorm:"not null"`
+
+	// totals over the executed messages of the tipset
+	GasLimit int64  `gorm:"not null;default:0"`
+	GasUsed  int64  `gorm:"not null;default:0"`
+	Burnt    string `gorm:"type:varchar(255);not null;default:'0'"`
+}
@@ -0,0 +1,10 @@
+package orm
+
+import "gorm.io/gorm"
+
+// Checkpoint represents table checkpoint in the database, it holds the last epoch synced by each indexer handler
+type Checkpoint struct {
+	gorm.Model
+	Handler string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Height  int64  `gorm:"not null"`
+}
@@ -0,0 +1,19 @@
+package orm
+
+import "gorm.io/gorm"
+
+// FeeSample represents table fee_samples in the database, a row samples the FIP-0100 daily fees and the
+// burnt funds at a tipset. Amounts are in attoFIL.
+type FeeSample struct {
+	gorm.Model
+	Height    int64 `gorm:"not null;uniqueIndex"`
+	Timestamp int64 `gorm:"not null;index"`
+	// DailyFee is the sum of the daily fees of the deadlines of all miners, the fee charged each day
+	DailyFee string `gorm:"type:varchar(255);not null"`
+	// Miners is the number of miners with a daily fee
+	Miners int `gorm:"not null"`
+	// SectorDailyFee is the daily fee of a 32GiB sector of quality-adjusted power onboarded at the sample
+	SectorDailyFee    string `gorm:"type:varchar(255);not null"`
+	BurntFunds        string `gorm:"type:varchar(255);not null"`
+	CirculatingSupply string `gorm:"type:varchar(255);not null"`
+}
@@ -0,0 +1,21 @@
+package orm
+
+import "gorm.io/gorm"
+
+// MessageTermination represents table message_terminations in the database, a row is the termination fee a
+// miner paid while executing a TerminateSectors message. The fees of the terminations cron runs, deferred ones
+// and sectors faulty for too long, are not included. Amounts are in attoFIL.
+type MessageTermination struct {
+	gorm.Model
+	Height    int64  `gorm:"not null;index"`
+	Cid       string `gorm:"type:varchar(255);column:cid;not null"`
+	Timestamp int64  `gorm:"not null;index"`
+	MsgCid    string `gorm:"type:varchar(255);column:msg_cid;uniqueIndex:idx_message_terminations_msg_call;not null"`
+	// CallIndex is the position of the call burning the fee in the execution trace of the message
+	CallIndex int    `gorm:"not null;uniqueIndex:idx_message_terminations_msg_call"`
+	Miner     string `gorm:"type:varchar(255);not null;index"`
+	// DeclaredSectors is the number of sectors declared in the params of the call, some may be terminated
+	// later by cron when a miner terminates too many at once
+	DeclaredSectors int64  `gorm:"not null"`
+	Fee             string `gorm:"type:varchar(255);not null"`
+}
@@ -0,0 +1,15 @@
+package orm
+
+import "gorm.io/gorm"
+
+// AutoMigrate migrates the schema of models, applying first the changes gorm's AutoMigrate can't make on its own
+func AutoMigrate(db *gorm.DB, models ...any) error {
+	// miner.msg_cid is no longer unique on its own since one message can create several miners through internal calls
+	if db.Migrator().HasIndex(&Miner{}, "uni_miners_msg_cid") {
+		if err := db.Migrator().DropIndex(&Miner{}, "uni_miners_msg_cid"); err != nil {
+			return err
+		}
+	}
+
+	return db.AutoMigrate(models...)
+}
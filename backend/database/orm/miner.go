@@ -2,13 +2,29 @@ package orm
 
 import "gorm.io/gorm"
 
-// Miner represents table miner in the database
+// Miner represents table miner in the database, a row is either a CreateMiner message sent to the power
+// actor (direct) or a CreateMiner call made by another actor such as a multisig or a contract (internal)
 type Miner struct {
 	gorm.Model
 	Height    int64  `gorm:"not null"`
 	Cid       string `gorm:"type:varchar(255);column:cid;not null"`
 	Timestamp int64  `gorm:"not null"`
-	MsgCid    string `gorm:"type:varchar(255);column:msg_cid;unique;not null"`
+	MsgCid    string `gorm:"type:varchar(255);column:msg_cid;uniqueIndex:idx_miners_msg_call;not null"`
+	CallIndex int    `gorm:"not null;default:0;uniqueIndex:idx_miners_msg_call"`
+	Internal  bool   `gorm:"not null;default:false"`
 	From      string `gorm:"type:varchar(255);not null"`
 	Cost      string `gorm:"type:varchar(255);not null"`
+	ExitCode  int64  `gorm:"not null;default:0;index"`
+
+	// decoded CreateMiner params
+	Owner               string `gorm:"type:varchar(255)"`
+	Worker              string `gorm:"type:varchar(255)"`
+	WindowPoStProofType int64  `gorm:"index"`
+	SectorSize          uint64 `gorm:"index"`
+	PeerID              string `gorm:"type:varchar(255)"`
+	Multiaddrs          string `gorm:"type:text"`
+
+	// decoded CreateMiner return, empty when the message failed
+	MinerID       string `gorm:"type:varchar(255);index"`
+	RobustAddress string `gorm:"type:varchar(255)"`
 }
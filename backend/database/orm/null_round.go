@@ -0,0 +1,10 @@
+package orm
+
+import "gorm.io/gorm"
+
+// NullRound represents table null_round in the database, it records epochs in which no block was mined
+type NullRound struct {
+	gorm.Model
+	Height    int64 `gorm:"not null;uniqueIndex"`
+	Timestamp int64 `gorm:"not null"`
+}
@@ -0,0 +1,21 @@
+package orm
+
+import "gorm.io/gorm"
+
+// PledgeSample represents table pledge_samples in the database, a row samples the initial pledge of new
+// sectors and the block reward at a tipset. Amounts are in attoFIL.
+type PledgeSample struct {
+	gorm.Model
+	Height    int64 `gorm:"not null;uniqueIndex"`
+	Timestamp int64 `gorm:"not null;index"`
+	// InitialPledge32GiB and InitialPledge64GiB are the pledges of sectors of 32GiB and 64GiB of
+	// quality-adjusted power, without verified deals
+	InitialPledge32GiB string `gorm:"type:varchar(255);column:initial_pledge_32gib;not null"`
+	InitialPledge64GiB string `gorm:"type:varchar(255);column:initial_pledge_64gib;not null"`
+	CirculatingSupply  string `gorm:"type:varchar(255);not null"`
+	// EpochReward is the reward paid per win count in the epoch, EpochRewardEstimate its smoothed estimate
+	EpochReward         string `gorm:"type:varchar(255);not null"`
+	EpochRewardEstimate string `gorm:"type:varchar(255);not null"`
+	// SectorDailyReward is the expected reward of a 32GiB sector of quality-adjusted power over one day
+	SectorDailyReward string `gorm:"type:varchar(255);not null"`
+}
@@ -0,0 +1,30 @@
+package orm
+
+import "gorm.io/gorm"
+
+// PowerSample represents table power_samples in the database, a row samples the power of the network at a
+// tipset. Powers are in bytes.
+type PowerSample struct {
+	gorm.Model
+	Height          int64  `gorm:"not null;uniqueIndex"`
+	Timestamp       int64  `gorm:"not null;index"`
+	RawBytePower    string `gorm:"type:varchar(255);not null"`
+	QualityAdjPower string `gorm:"type:varchar(255);not null"`
+	// MinerCount is the number of miners with a power claim, MinersAboveMinPower the ones that proved the
+	// consensus minimum power and can win blocks
+	MinerCount          int64 `gorm:"not null"`
+	MinersAboveMinPower int64 `gorm:"not null"`
+}
+
+// MinerPower represents table miner_powers in the database, a row is the power of a miner created since
+// indexing started, sampled at a tipset. Powers are in bytes.
+type MinerPower struct {
+	gorm.Model
+	Height          int64  `gorm:"not null;uniqueIndex:idx_miner_powers_height_miner"`
+	Timestamp       int64  `gorm:"not null;index"`
+	Miner           string `gorm:"type:varchar(255);not null;uniqueIndex:idx_miner_powers_height_miner;index"`
+	RawBytePower    string `gorm:"type:varchar(255);not null"`
+	QualityAdjPower string `gorm:"type:varchar(255);not null"`
+	// HasMinPower tells whether the miner reached the consensus minimum power
+	HasMinPower bool `gorm:"not null;default:false"`
+}
@@ -0,0 +1,23 @@
+package orm
+
+import "gorm.io/gorm"
+
+// SectorMessage represents table sector_messages in the database, a row is a message sent to a miner actor
+// to onboard or maintain sectors, such as a precommit, a prove-commit, a replica update or an extension of
+// sector expirations
+type SectorMessage struct {
+	gorm.Model
+	Height    int64  `gorm:"not null;index"`
+	Cid       string `gorm:"type:varchar(255);column:cid;not null"`
+	Timestamp int64  `gorm:"not null;index"`
+	MsgCid    string `gorm:"type:varchar(255);column:msg_cid;uniqueIndex;not null"`
+	Miner     string `gorm:"type:varchar(255);not null;index"`
+	From      string `gorm:"type:varchar(255);not null"`
+	Method    int64  `gorm:"not null"`
+	// MethodName is the name of the miner actor method, such as ProveCommitSectors3
+	MethodName string `gorm:"type:varchar(64);not null;index"`
+	// SectorCount is the number of sectors in the params, 0 when they don't decode
+	SectorCount int64 `gorm:"not null"`
+	GasUsed     int64 `gorm:"not null"`
+	ExitCode    int64 `gorm:"not null;default:0;index"`
+}
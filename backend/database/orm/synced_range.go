@@ -0,0 +1,12 @@
+package orm
+
+import "gorm.io/gorm"
+
+// SyncedRange represents table synced_range in the database, it holds the inclusive ranges of epochs processed
+// by each indexer handler, ranges that overlap or touch are merged
+type SyncedRange struct {
+	gorm.Model
+	Handler     string `gorm:"type:varchar(64);not null;index:idx_synced_ranges_handler_start"`
+	StartHeight int64  `gorm:"not null;index:idx_synced_ranges_handler_start"`
+	EndHeight   int64  `gorm:"not null"`
+}
@@ -0,0 +1,19 @@
+package orm
+
+import "gorm.io/gorm"
+
+// Finality rules the indexer uses to decide how far it may advance
+const (
+	FinalityF3 = "f3"
+	FinalityEC = "ec"
+)
+
+// TipSet represents table tip_set in the database, it records the key of every indexed tipset
+// so that the indexer can detect chain reorgs
+type TipSet struct {
+	gorm.Model
+	Height    int64  `gorm:"not null;uniqueIndex"`
+	Key       string `gorm:"type:text;not null"`
+	ParentKey string `gorm:"type:text;not null"`
+	Finality  string `gorm:"type:varchar(8);not null"`
+}
@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func init() {
+	Register(newChainStatsHandler)
+}
+
+func newChainStatsHandler() *Handler {
+	return &Handler{
+		Name: "chain_stats",
+		TipSet: func(tx *Tx, tipSetMeta *chain.TipSetMeta) error {
+			// a tipset is identified by its height, indexing it again replaces the row
+			tx.Upsert(NewChainStatRecord(tipSetMeta))
+			return nil
+		},
+		Models: []any{&orm.ChainStat{}},
+	}
+}
+
+// NewChainStatRecord summarizes a tipset and the totals of its executed messages into a row
+func NewChainStatRecord(tipSetMeta *chain.TipSetMeta) *orm.ChainStat {
+	stat := &orm.ChainStat{
+		Height:        tipSetMeta.Height,
+		Timestamp:     tipSetMeta.Timestamp,
+		Blocks:        len(tipSetMeta.Blocks),
+		ParentBaseFee: tipSetMeta.ParentBaseFee.String(),
+		MessageCount:  tipSetMeta.MessageCount,
+		GasLimit:      tipSetMeta.GasLimit,
+		GasUsed:       tipSetMeta.GasUsed,
+		Burnt:         "0",
+	}
+
+	for _, blk := range tipSetMeta.Blocks {
+		if blk.ElectionProof != nil {
+			stat.WinCount += blk.ElectionProof.WinCount
+		}
+	}
+
+	if !tipSetMeta.Burnt.Nil() {
+		stat.Burnt = tipSetMeta.Burnt.String()
+	}
+
+	if len(tipSetMeta.Blocks) > 0 {
+		stat.ParentWeight = tipSetMeta.Blocks[0].ParentWeight.String()
+	}
+
+	return stat
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestChainStats(t *testing.T) {
+	fc := chaintest.NewChain(100)
+
+	from, _ := address.NewIDAddress(100)
+	newMessage := func(nonce uint64) *types.Message {
+		return &types.Message{From: from, To: from, Nonce: nonce, Value: abi.NewTokenAmount(0), GasLimit: 1000,
+			GasFeeCap: abi.NewTokenAmount(200), GasPremium: abi.NewTokenAmount(1)}
+	}
+
+	dup := newMessage(0)
+	fc.AddTipSet(
+		&types.BlockMessages{BlsMessages: []*types.Message{dup, newMessage(1)}},
+		&types.BlockMessages{BlsMessages: []*types.Message{dup}},
+	)
+	fc.NullRounds(1)
+	fc.Add()
+	fc.Add()
+
+	stats := indexRows[orm.ChainStat](t, chain.NewNodeFromSource(context.Background(), fc), newChainStatsHandler())
+	if len(stats) != 2 {
+		t.Fatalf("expected a row per tipset, got %d", len(stats))
+	}
+
+	// the message included in both blocks is executed once
+	first := stats[0]
+	if first.Height != 101 || first.Blocks != 2 || first.WinCount != 2 || first.MessageCount != 2 {
+		t.Errorf("unexpected stats %+v", first)
+	}
+	if first.ParentBaseFee != "100" || first.ParentWeight != "101" || first.Timestamp != chaintest.GenesisTimestamp+101*30 {
+		t.Errorf("unexpected stats %+v", first)
+	}
+
+	// messages use all their gas by default, so only the base fee of 100 is burned
+	if first.GasLimit != 2000 || first.GasUsed != 2000 || first.Burnt != "200000" {
+		t.Errorf("unexpected gas totals %+v", first)
+	}
+
+	if stats[1].Height != 103 || stats[1].Blocks != 1 || stats[1].MessageCount != 0 || stats[1].Burnt != "0" {
+		t.Errorf("unexpected stats after the null round %+v", stats[1])
+	}
+
+	// the totals cover every executed message, whatever filter the handler is configured with
+	handler := newChainStatsHandler()
+	handler.Filter = Filter{Methods: []abi.MethodNum{1}}
+	filtered := indexRows[orm.ChainStat](t, chain.NewNodeFromSource(context.Background(), fc), handler)
+	if len(filtered) != 2 || *filtered[0] != *first {
+		t.Errorf("expected the same stats with a filter, got %+v", filtered)
+	}
+}
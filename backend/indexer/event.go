@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// codecDagCBOR is the codec of the entries of built-in actor events
+const codecDagCBOR = 0x51
+
+func init() {
+	RegisterOptional(newActorEventHandler)
+}
+
+// newActorEventHandler indexes the actor events, by default all of them, the node must have its actor
+// events API enabled
+func newActorEventHandler() *Handler {
+	return &Handler{
+		Name: "actor_events",
+		Event: func(tx *Tx, blockMeta *chain.BlockMeta, event *chain.Event) error {
+			record, err := NewActorEventRecord(blockMeta, event)
+			if err != nil {
+				return err
+			}
+
+			// an event is identified by its message and index, indexing it again replaces the row
+			tx.Upsert(record)
+			return nil
+		},
+		Models: []any{&orm.ActorEvent{}},
+	}
+}
+
+// NewActorEventRecord decodes an actor event into a row, the entries of built-in actor events are decoded
+// from CBOR to JSON and the topics and data of EVM logs are hex encoded
+func NewActorEventRecord(blockMeta *chain.BlockMeta, event *chain.Event) (*orm.ActorEvent, error) {
+	record := &orm.ActorEvent{
+		Height:     blockMeta.Height,
+		Timestamp:  blockMeta.Timestamp,
+		MsgCid:     event.MsgCid.String(),
+		EventIndex: event.Index,
+		Emitter:    event.Emitter.String(),
+		Type:       event.Type(),
+	}
+
+	// implicit messages are not included in a block
+	if blockMeta.Cid.Defined() {
+		record.Cid = blockMeta.Cid.String()
+	}
+
+	topics := event.Topics()
+	for idx, topic := range []*string{&record.Topic1, &record.Topic2, &record.Topic3, &record.Topic4} {
+		if idx < len(topics) {
+			*topic = hexBytes(topics[idx])
+		}
+	}
+
+	if data := event.Data(); data != nil {
+		record.Data = hexBytes(data)
+	}
+
+	if record.Type == "" {
+		return record, nil
+	}
+
+	fields := make(map[string]json.RawMessage, len(event.Entries))
+	for _, entry := range event.Entries {
+		if entry.Key == "$type" {
+			continue
+		}
+
+		fields[entry.Key] = decodeEntry(entry.Codec, entry.Value)
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("encode fields of event %d of %s: %w", event.Index, event.MsgCid, err)
+	}
+	record.Fields = string(raw)
+
+	return record, nil
+}
+
+// decodeEntry returns the JSON form of a CBOR entry value, values that are not CBOR or don't decode are
+// kept as hex
+func decodeEntry(codec uint64, value []byte) json.RawMessage {
+	if codec == codecDagCBOR {
+		if node, err := cbor.Decode(value, multihash.SHA2_256, -1); err == nil {
+			if raw, err := node.MarshalJSON(); err == nil {
+				return raw
+			}
+		}
+	}
+
+	raw, _ := json.Marshal(hexBytes(value))
+	return raw
+}
+
+func hexBytes(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
@@ -0,0 +1,61 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/ipfs-force-community/janus/chain"
+)
+
+func TestNewActorEventRecord(t *testing.T) {
+	emitter, _ := address.NewIDAddress(1000)
+	prefix := cid.NewPrefixV1(cid.DagCBOR, multihash.BLAKE2B_MIN+31)
+	msgCid, _ := prefix.Sum([]byte("message"))
+	blockCid, _ := prefix.Sum([]byte("block"))
+
+	topic := make([]byte, 32)
+	topic[31] = 7
+	log := &chain.Event{MsgCid: msgCid, Index: 1, Emitter: emitter, Entries: []types.EventEntry{
+		{Key: "t1", Codec: 0x55, Value: topic},
+		{Key: "t2", Codec: 0x55, Value: topic},
+		{Key: "d", Codec: 0x55, Value: []byte{0xca, 0xfe}},
+	}}
+
+	record, err := NewActorEventRecord(&chain.BlockMeta{Height: 100, Cid: blockCid, Timestamp: 42}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Height != 100 || record.Cid != blockCid.String() || record.MsgCid != msgCid.String() || record.EventIndex != 1 {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	if record.Topic1 != hexBytes(topic) || record.Topic2 != hexBytes(topic) || record.Topic3 != "" || record.Data != "0xcafe" {
+		t.Fatalf("unexpected topics or data %+v", record)
+	}
+	if record.Type != "" || record.Fields != "" {
+		t.Fatalf("unexpected built-in fields for a log %+v", record)
+	}
+
+	// {"$type": "sector-activated", "sector": 9} emitted by cron, outside of any block
+	activated := &chain.Event{MsgCid: msgCid, Emitter: emitter, Entries: []types.EventEntry{
+		{Key: "$type", Codec: 0x51, Value: append([]byte{0x70}, "sector-activated"...)},
+		{Key: "sector", Codec: 0x51, Value: []byte{0x09}},
+		{Key: "raw", Codec: 0x55, Value: []byte{0x01}},
+	}}
+
+	record, err = NewActorEventRecord(&chain.BlockMeta{Height: 100}, activated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Cid != "" || record.Type != "sector-activated" || record.Topic1 != "" || record.Data != "" {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	if record.Fields != `{"raw":"0x01","sector":9}` {
+		t.Fatalf("unexpected fields %s", record.Fields)
+	}
+}
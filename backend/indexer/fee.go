@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+const (
+	// feeSampleInterval is the default number of epochs between two fee samples, one day
+	feeSampleInterval = 2880
+	// feeSampleConcurrency limits the number of miners whose deadlines are read in parallel
+	feeSampleConcurrency = 16
+)
+
+// sectorSize32GiB is the quality-adjusted power of the sector the daily fee is sampled for
+var sectorSize32GiB = big.NewInt(32 << 30)
+
+func init() {
+	RegisterOptional(newFeeSamplesHandler)
+}
+
+// newFeeSamplesHandler samples the FIP-0100 daily fees of the network and the balance of the burnt funds
+// actor, reading the deadlines of every miner makes a sample take a few thousand state calls
+func newFeeSamplesHandler() *Handler {
+	return &Handler{
+		Name: "fee_samples",
+		Sample: func(ctx context.Context, tx *Tx, _ *gorm.DB, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) error {
+			record, err := SampleFees(ctx, node, tipSetMeta)
+			if err != nil {
+				return err
+			}
+
+			// a sample is identified by its height, sampling it again replaces the row
+			tx.Upsert(record)
+			return nil
+		},
+		Interval: feeSampleInterval,
+		Models:   []any{&orm.FeeSample{}},
+	}
+}
+
+// SampleFees reads the daily fees of the deadlines of all miners, the burnt funds and the circulating supply
+// in the state of the tipset
+func SampleFees(ctx context.Context, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) (*orm.FeeSample, error) {
+	tsk := tipSetMeta.Key
+
+	miners, err := node.StateListMiners(ctx, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("list miners at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	var lk sync.Mutex
+	total, paying := big.Zero(), 0
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(feeSampleConcurrency)
+	for _, maddr := range miners {
+		g.Go(func() error {
+			fee, err := minerDailyFee(gctx, node, maddr, tsk)
+			if err != nil {
+				return err
+			}
+
+			if fee.IsZero() {
+				return nil
+			}
+
+			lk.Lock()
+			defer lk.Unlock()
+
+			total = big.Add(total, fee)
+			paying++
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, fmt.Errorf("sample fees at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	burnt, err := node.StateGetActor(ctx, builtin.BurntFundsActorAddr, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get burnt funds actor at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	supply, err := node.StateVMCirculatingSupplyInternal(ctx, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get circulating supply at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	return &orm.FeeSample{
+		Height:            tipSetMeta.Height,
+		Timestamp:         tipSetMeta.Timestamp,
+		DailyFee:          total.String(),
+		Miners:            paying,
+		SectorDailyFee:    miner.DailyProofFee(supply.FilCirculating, sectorSize32GiB).String(),
+		BurntFunds:        burnt.Balance.String(),
+		CirculatingSupply: supply.FilCirculating.String(),
+	}, nil
+}
+
+// minerDailyFee returns the sum of the daily fees of the deadlines of a miner, deadlines read from a state
+// before FIP-0100 have no fee
+func minerDailyFee(ctx context.Context, node chain.ChainSource, maddr address.Address, tsk types.TipSetKey) (abi.TokenAmount, error) {
+	deadlines, err := node.StateMinerDeadlines(ctx, maddr, tsk)
+	if err != nil {
+		return big.Zero(), fmt.Errorf("get deadlines of miner %s: %w", maddr, err)
+	}
+
+	fee := big.Zero()
+	for _, deadline := range deadlines {
+		if !deadline.DailyFee.Nil() {
+			fee = big.Add(fee, deadline.DailyFee)
+		}
+	}
+
+	return fee, nil
+}
@@ -0,0 +1,46 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+func TestSampleFees(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	ts := fc.Add()
+
+	paying, _ := address.NewIDAddress(1000)
+	idle, _ := address.NewIDAddress(1001)
+	// the deadline without a fee was last updated before FIP-0100
+	fc.SetMinerDeadlines(paying, types.Deadline{DailyFee: abi.NewTokenAmount(10)}, types.Deadline{DailyFee: abi.NewTokenAmount(20)}, types.Deadline{})
+	fc.SetMinerDeadlines(idle, types.Deadline{DailyFee: big.Zero()})
+	fc.SetActor(builtin.BurntFundsActorAddr, &types.Actor{Balance: abi.NewTokenAmount(5000)})
+
+	supply := big.Mul(big.NewInt(600_000_000), big.NewInt(1e18))
+	fc.SetCirculatingSupply(types.CirculatingSupply{FilCirculating: supply})
+
+	tipSetMeta := &chain.TipSetMeta{Height: int64(ts.Height()), Key: ts.Key(), Timestamp: int64(ts.MinTimestamp())}
+	sample, err := SampleFees(ctx, chain.NewNodeFromSource(ctx, fc), tipSetMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sample.DailyFee != "30" || sample.Miners != 1 || sample.BurntFunds != "5000" || sample.CirculatingSupply != supply.String() {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+
+	if expected := miner.DailyProofFee(supply, big.NewInt(32<<30)); sample.SectorDailyFee != expected.String() || expected.IsZero() {
+		t.Errorf("expected a sector daily fee of %s, got %s", expected, sample.SectorDailyFee)
+	}
+}
@@ -0,0 +1,203 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/actors"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/janus/chain"
+)
+
+// actorNameCacheSize bounds the number of actors whose name is kept in memory
+const actorNameCacheSize = 100000
+
+// actorKey identifies an actor at an address with a given code, the actor at an address may change code,
+// such as a placeholder which becomes an EVM actor
+type actorKey struct {
+	addr address.Address
+	code cid.Cid
+}
+
+// Filter selects the messages, calls and events passed to a handler, an empty field matches everything.
+// Emitters and Topics only apply to events, the other fields to messages and calls.
+type Filter struct {
+	// To lists the accepted recipients, compared as they appear in the message
+	To []address.Address
+	// Actors lists the accepted actor names of the recipient, such as storageminer, multisig or evm
+	Actors []string
+	// FromActors lists the accepted actor names of the sender, like Actors
+	FromActors []string
+	// Methods lists the accepted method numbers
+	Methods []abi.MethodNum
+	// MinValue is the minimum value transferred, any value is accepted when it is nil
+	MinValue abi.TokenAmount
+	// Emitters lists the accepted actors emitting the event, f4 addresses for contracts
+	Emitters []address.Address
+	// Topics lists the accepted event kinds, the first topic of an EVM log as 0x prefixed hex, such as the
+	// hash of the event signature, or the $type of a built-in actor event, such as sector-activated
+	Topics []string
+}
+
+// FilterConfig is the YAML form of a Filter, set fields replace the ones of the default filter of the handler
+type FilterConfig struct {
+	To         []string `yaml:"to"`
+	Actors     []string `yaml:"actors"`
+	FromActors []string `yaml:"from_actors"`
+	Methods    []uint64 `yaml:"methods"`
+	// MinValue is in FIL, for example "0.5" or "10 FIL"
+	MinValue string   `yaml:"min_value"`
+	Emitters []string `yaml:"emitters"`
+	Topics   []string `yaml:"topics"`
+}
+
+// apply returns filter with the fields set in the config replaced
+func (c *FilterConfig) apply(filter Filter) (Filter, error) {
+	if c == nil {
+		return filter, nil
+	}
+
+	if len(c.To) > 0 {
+		filter.To = nil
+		for _, to := range c.To {
+			addr, err := address.NewFromString(to)
+			if err != nil {
+				return filter, fmt.Errorf("invalid recipient %s: %w", to, err)
+			}
+
+			filter.To = append(filter.To, addr)
+		}
+	}
+
+	if len(c.Actors) > 0 {
+		filter.Actors = c.Actors
+	}
+
+	if len(c.FromActors) > 0 {
+		filter.FromActors = c.FromActors
+	}
+
+	if len(c.Methods) > 0 {
+		filter.Methods = nil
+		for _, method := range c.Methods {
+			filter.Methods = append(filter.Methods, abi.MethodNum(method))
+		}
+	}
+
+	if c.MinValue != "" {
+		value, err := types.ParseFIL(c.MinValue)
+		if err != nil {
+			return filter, fmt.Errorf("invalid min value %s: %w", c.MinValue, err)
+		}
+
+		filter.MinValue = abi.TokenAmount(value)
+	}
+
+	if len(c.Emitters) > 0 {
+		filter.Emitters = nil
+		for _, emitter := range c.Emitters {
+			addr, err := address.NewFromString(emitter)
+			if err != nil {
+				return filter, fmt.Errorf("invalid emitter %s: %w", emitter, err)
+			}
+
+			filter.Emitters = append(filter.Emitters, addr)
+		}
+	}
+
+	if len(c.Topics) > 0 {
+		filter.Topics = c.Topics
+	}
+
+	return filter, nil
+}
+
+// match reports whether a message or call with the given sender, recipient, method and value passes the
+// filter, actorName is only called when the filter checks the actor of the sender or recipient and its error
+// is returned
+func (f *Filter) match(from, to address.Address, method abi.MethodNum, value abi.TokenAmount, actorName func(address.Address) (string, error)) (bool, error) {
+	if len(f.To) > 0 && !slices.Contains(f.To, to) {
+		return false, nil
+	}
+
+	if len(f.Methods) > 0 && !slices.Contains(f.Methods, method) {
+		return false, nil
+	}
+
+	if !f.MinValue.Nil() && (value.Nil() || value.LessThan(f.MinValue)) {
+		return false, nil
+	}
+
+	for _, check := range []struct {
+		addr   address.Address
+		actors []string
+	}{{to, f.Actors}, {from, f.FromActors}} {
+		if len(check.actors) == 0 {
+			continue
+		}
+
+		name, err := actorName(check.addr)
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(check.actors, name) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// matchEvent reports whether an actor event passes the filter
+func (f *Filter) matchEvent(event *chain.Event) bool {
+	if len(f.Emitters) > 0 && !slices.Contains(f.Emitters, event.Emitter) {
+		return false
+	}
+
+	if len(f.Topics) == 0 {
+		return true
+	}
+
+	topic := event.Type()
+	if topics := event.Topics(); len(topics) > 0 {
+		topic = "0x" + hex.EncodeToString(topics[0])
+	}
+
+	return slices.ContainsFunc(f.Topics, func(t string) bool {
+		return strings.EqualFold(t, topic)
+	})
+}
+
+// actorName returns a function resolving the name of the actor at an address in the state of the tipset tsk,
+// the name is an empty string when there is no actor at the address or its code is unknown. Any other failure
+// to look it up is returned, so that the message is not silently left out.
+func (i *Indexer) actorName(tsk types.TipSetKey) func(address.Address) (string, error) {
+	return func(addr address.Address) (string, error) {
+		actor, err := i.node.StateGetActor(i.ctx, addr, tsk)
+		if chain.IsActorNotFound(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("get actor %s at %s: %w", addr, tsk, err)
+		}
+
+		key := actorKey{addr: addr, code: actor.Code}
+		if name, ok := i.actorNames.Get(key); ok {
+			return name, nil
+		}
+
+		name, _, ok := actors.GetActorMetaByCode(actor.Code)
+		if !ok {
+			return "", nil
+		}
+
+		i.actorNames.Add(key, name)
+		return name, nil
+	}
+}
@@ -0,0 +1,202 @@
+package indexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+)
+
+func TestFilterMatch(t *testing.T) {
+	miner, _ := address.NewIDAddress(1000)
+	actorName := func(addr address.Address) (string, error) {
+		if addr == miner {
+			return "storageminer", nil
+		}
+		return "account", nil
+	}
+
+	filter := Filter{
+		To:       []address.Address{builtin.StoragePowerActorAddr, miner},
+		Methods:  []abi.MethodNum{builtin.MethodsPower.CreateMiner, builtin.MethodSend},
+		MinValue: big.NewInt(10),
+	}
+
+	tests := []struct {
+		name   string
+		to     address.Address
+		method abi.MethodNum
+		value  abi.TokenAmount
+		want   bool
+	}{
+		{name: "match", to: builtin.StoragePowerActorAddr, method: builtin.MethodsPower.CreateMiner, value: big.NewInt(10), want: true},
+		{name: "other recipient", to: builtin.RewardActorAddr, method: builtin.MethodsPower.CreateMiner, value: big.NewInt(10)},
+		{name: "other method", to: miner, method: builtin.MethodsPower.CreateMiner + 1, value: big.NewInt(10)},
+		{name: "value too low", to: miner, method: builtin.MethodSend, value: big.NewInt(9)},
+		{name: "no value", to: miner, method: builtin.MethodSend, value: abi.TokenAmount{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := filter.match(tt.to, tt.to, tt.method, tt.value, actorName); err != nil || got != tt.want {
+				t.Errorf("expected %v, got %v, %v", tt.want, got, err)
+			}
+		})
+	}
+
+	empty := Filter{}
+	if ok, _ := empty.match(builtin.RewardActorAddr, builtin.RewardActorAddr, 42, abi.TokenAmount{}, actorName); !ok {
+		t.Error("expected an empty filter to match everything")
+	}
+
+	byActor := Filter{Actors: []string{"storageminer"}}
+	matchMiner, _ := byActor.match(miner, miner, 0, big.Zero(), actorName)
+	matchReward, _ := byActor.match(miner, builtin.RewardActorAddr, 0, big.Zero(), actorName)
+	if !matchMiner || matchReward {
+		t.Error("expected the actor filter to only match the miner")
+	}
+
+	fromMiner := Filter{FromActors: []string{"storageminer"}}
+	sentByMiner, _ := fromMiner.match(miner, builtin.BurntFundsActorAddr, 0, big.Zero(), actorName)
+	sentByReward, _ := fromMiner.match(builtin.RewardActorAddr, builtin.BurntFundsActorAddr, 0, big.Zero(), actorName)
+	if !sentByMiner || sentByReward {
+		t.Error("expected the sender actor filter to only match calls from the miner")
+	}
+
+	// a failed lookup is not a mismatch
+	failing := func(address.Address) (string, error) { return "", errors.New("node unavailable") }
+	if _, err := byActor.match(miner, miner, 0, big.Zero(), failing); err == nil {
+		t.Error("expected the lookup error to be returned")
+	}
+}
+
+func TestFilterMatchEvent(t *testing.T) {
+	contract, _ := address.NewIDAddress(1000)
+	miner, _ := address.NewIDAddress(2000)
+
+	transfer := make([]byte, 32)
+	transfer[0] = 0xdd
+	log := &chain.Event{Emitter: contract, Entries: []types.EventEntry{{Key: "t1", Codec: 0x55, Value: transfer}}}
+	activated := &chain.Event{Emitter: miner, Entries: []types.EventEntry{
+		{Key: "$type", Codec: 0x51, Value: append([]byte{0x70}, "sector-activated"...)},
+	}}
+
+	empty := Filter{}
+	if !empty.matchEvent(log) || !empty.matchEvent(activated) {
+		t.Error("expected an empty filter to match every event")
+	}
+
+	byTopic := Filter{Topics: []string{"0xDD" + strings.Repeat("00", 31), "sector-activated"}}
+	if !byTopic.matchEvent(log) || !byTopic.matchEvent(activated) {
+		t.Error("expected the topic filter to match the log and the built-in event")
+	}
+
+	byEmitter := Filter{Emitters: []address.Address{miner}, Topics: []string{"sector-activated"}}
+	if byEmitter.matchEvent(log) || !byEmitter.matchEvent(activated) {
+		t.Error("expected the emitter filter to only match the miner event")
+	}
+
+	// message fields don't apply to events
+	byRecipient := Filter{To: []address.Address{builtin.StoragePowerActorAddr}}
+	if !byRecipient.matchEvent(log) {
+		t.Error("expected the recipient filter to be ignored for events")
+	}
+}
+
+func TestFilterConfigApply(t *testing.T) {
+	defaults := Filter{
+		To:      []address.Address{builtin.StoragePowerActorAddr},
+		Methods: []abi.MethodNum{builtin.MethodsPower.CreateMiner},
+	}
+
+	filter, err := (&FilterConfig{Actors: []string{"multisig"}, MinValue: "0.5"}).apply(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(filter.To) != 1 || len(filter.Methods) != 1 {
+		t.Errorf("expected unset fields to keep their default, got %+v", filter)
+	}
+
+	if len(filter.Actors) != 1 || filter.Actors[0] != "multisig" {
+		t.Errorf("expected actors to be replaced, got %v", filter.Actors)
+	}
+
+	if !filter.MinValue.Equals(big.NewInt(5e17)) {
+		t.Errorf("expected min value of 0.5 FIL, got %s", filter.MinValue)
+	}
+
+	if _, err := (&FilterConfig{To: []string{"not an address"}}).apply(defaults); err == nil {
+		t.Error("expected an invalid recipient to be rejected")
+	}
+
+	filter, err = (&FilterConfig{Emitters: []string{"f01000"}, Topics: []string{"sector-activated"}}).apply(defaults)
+	if err != nil || len(filter.Emitters) != 1 || len(filter.Topics) != 1 {
+		t.Errorf("expected emitters and topics to be set, got %+v, %v", filter, err)
+	}
+
+	if _, err := (&FilterConfig{Emitters: []string{"not an address"}}).apply(defaults); err == nil {
+		t.Error("expected an invalid emitter to be rejected")
+	}
+
+	var unset *FilterConfig
+	if filter, err := unset.apply(defaults); err != nil || len(filter.To) != 1 {
+		t.Errorf("expected a nil config to keep the default filter, got %+v, %v", filter, err)
+	}
+}
+
+func TestNewHandlers(t *testing.T) {
+	handlers, err := NewHandlers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handlers) != len(DefaultHandlers()) {
+		t.Errorf("expected every default handler, got %d", len(handlers))
+	}
+	for _, handler := range handlers {
+		if optional[handler.Name] {
+			t.Errorf("optional handler %s built by default", handler.Name)
+		}
+	}
+	if !optional["actor_events"] || !optional["fee_samples"] || optional["create_miner"] {
+		t.Errorf("unexpected optional handlers %v", optional)
+	}
+
+	handlers, err = NewHandlers([]HandlerConfig{{Name: "create_miner", Filter: &FilterConfig{MinValue: "1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handlers) != 1 || handlers[0].Name != "create_miner" || handlers[0].Filter.MinValue.Nil() {
+		t.Errorf("expected create_miner with a min value, got %+v", handlers)
+	}
+
+	if _, err := NewHandlers([]HandlerConfig{{Name: "unknown"}}); err == nil {
+		t.Error("expected an unknown handler to be rejected")
+	}
+
+	if _, err := NewHandlers([]HandlerConfig{{Name: "create_miner"}, {Name: "create_miner"}}); err == nil {
+		t.Error("expected a handler configured twice to be rejected")
+	}
+
+	handlers, err = NewHandlers([]HandlerConfig{{Name: "fee_samples", Interval: 120}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if handlers[0].Interval != 120 {
+		t.Errorf("expected the configured interval, got %d", handlers[0].Interval)
+	}
+
+	if _, err := NewHandlers([]HandlerConfig{{Name: "create_miner", Interval: 120}}); err == nil {
+		t.Error("expected an interval on a handler that doesn't sample to be rejected")
+	}
+}
@@ -0,0 +1,219 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/builtin/v16/power"
+	"github.com/filecoin-project/go-state-types/manifest"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected rows of the recordings in testdata")
+
+// recordedRange is an entry of testdata/recordings.json, a range of epochs recorded with janus record
+type recordedRange struct {
+	Recording string   `json:"recording"`
+	From      int64    `json:"from"`
+	To        int64    `json:"to"`
+	Handlers  []string `json:"handlers"`
+	// Trace is set when the range was recorded with --trace
+	Trace bool `json:"trace"`
+	// Synthetic is set when the recording was made from syntheticChain instead of a node, -update records it again
+	Synthetic bool `json:"synthetic"`
+}
+
+// TestRecordings replays the recordings listed in testdata/recordings.json through their handlers and compares
+// the rows with the ones stored next to the recording, run with -update to store them after adding a recording
+func TestRecordings(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("testdata", "recordings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ranges []recordedRange
+	if err := json.Unmarshal(manifest, &ranges); err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) == 0 {
+		t.Fatal("no recording in testdata/recordings.json")
+	}
+
+	for _, r := range ranges {
+		t.Run(r.Recording, func(t *testing.T) {
+			if r.Synthetic && *update {
+				recordSynthetic(t, r)
+			}
+
+			got := replayRows(t, r)
+
+			golden := filepath.Join("testdata", r.Recording+".rows.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rows of %s changed, run with -update if expected\n%s", r.Recording, got)
+			}
+		})
+	}
+}
+
+// replayRows runs the handlers of r over its recording and returns their rows as JSON, grouped by table
+func replayRows(t *testing.T, r recordedRange) []byte {
+	t.Helper()
+
+	ctx := context.Background()
+	replay, err := chain.OpenReplay(filepath.Join("testdata", r.Recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlers, err := NewHandlers(handlerConfigs(r.Handlers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make(map[string][]any)
+	i := NewIndexer(ctx, Options{Trace: r.Trace}, chain.NewNodeFromSource(ctx, replay), newTestDB(t), handlers...)
+	err = i.syncRange(r.From, r.To, handlers, map[string]int64{}, "", func(tx *Tx, start, end int64) error {
+		for _, q := range tx.queues {
+			table := q.rows.Type().Elem().Elem().Name()
+			for idx := range q.rows.Len() {
+				rows[table] = append(rows[table], q.rows.Index(idx).Interface())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(out, '\n')
+}
+
+func handlerConfigs(names []string) []HandlerConfig {
+	configs := make([]HandlerConfig, 0, len(names))
+	for _, name := range names {
+		configs = append(configs, HandlerConfig{Name: name})
+	}
+
+	return configs
+}
+
+// recordSynthetic records r over syntheticChain the way janus record does, without writing any row
+func recordSynthetic(t *testing.T, r recordedRange) {
+	t.Helper()
+
+	ctx := context.Background()
+	file, err := os.Create(filepath.Join("testdata", r.Recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	handlers, err := NewHandlers(handlerConfigs(r.Handlers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := chain.NewRecorder(syntheticChain(t), file)
+	i := NewIndexer(ctx, Options{Concurrency: 1, Trace: r.Trace, DryRun: true}, chain.NewNodeFromSource(ctx, recorder), nil, handlers...)
+	if err := i.Reindex(r.From, r.To, r.Handlers...); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// syntheticChain builds the chain of the synthetic recording: a miner created at 101, sector messages sent to it
+// at 102 and 104 after a null round, and a TerminateSectors message paying a fee at 105
+func syntheticChain(t *testing.T) *chaintest.Chain {
+	t.Helper()
+
+	fc := chaintest.NewChain(100)
+
+	owner, _ := address.NewIDAddress(1001)
+	minerAddr, _ := address.NewIDAddress(2000)
+	robust, _ := address.NewActorAddress([]byte("synthetic miner"))
+	sealed, _ := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte("sealed"))
+	fc.SetActor(minerAddr, &types.Actor{Code: actorCode(t, manifest.MinerKey)})
+
+	encode := func(v cbg.CBORMarshaler) []byte {
+		var buf bytes.Buffer
+		if err := v.MarshalCBOR(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	nonce := uint64(0)
+	newMessage := func(to address.Address, method abi.MethodNum, params []byte) *types.Message {
+		nonce++
+		return &types.Message{From: owner, To: to, Nonce: nonce, Value: abi.NewTokenAmount(0), GasLimit: 10000,
+			GasFeeCap: abi.NewTokenAmount(150), GasPremium: abi.NewTokenAmount(10), Method: method, Params: params}
+	}
+
+	createMiner := newMessage(builtin.StoragePowerActorAddr, builtin.MethodsPower.CreateMiner, encode(&power.CreateMinerParams{
+		Owner:               owner,
+		Worker:              owner,
+		WindowPoStProofType: abi.RegisteredPoStProof_StackedDrgWindow32GiBV1_1,
+		Multiaddrs:          []abi.Multiaddrs{},
+	}))
+	fc.SetReceipt(createMiner.Cid(), &types.MessageReceipt{GasUsed: 8000,
+		Return: encode(&power.CreateMinerReturn{IDAddress: minerAddr, RobustAddress: robust})})
+	fc.Add(createMiner)
+
+	fc.Add(newMessage(minerAddr, builtin.MethodsMiner.PreCommitSectorBatch2, encode(&miner.PreCommitSectorBatchParams2{
+		Sectors: []miner.SectorPreCommitInfo{{SectorNumber: 1, SealedCID: sealed}, {SectorNumber: 2, SealedCID: sealed}},
+	})))
+	fc.NullRounds(1)
+
+	// the message to another actor than a miner is left out by sector_messages
+	fc.Add(
+		newMessage(minerAddr, builtin.MethodsMiner.ProveCommitAggregate, encode(&miner.ProveCommitAggregateParams{
+			SectorNumbers: bitfield.NewFromSet([]uint64{1, 2}),
+		})),
+		newMessage(owner, builtin.MethodSend, nil),
+	)
+
+	terminate := newMessage(minerAddr, builtin.MethodsMiner.TerminateSectors, encode(&miner.TerminateSectorsParams{
+		Terminations: []miner.TerminationDeclaration{{Deadline: 1, Sectors: bitfield.NewFromSet([]uint64{2})}},
+	}))
+	fc.SetSubcalls(terminate.Cid(), types.ExecutionTrace{
+		Msg: types.MessageTrace{From: minerAddr, To: builtin.BurntFundsActorAddr, Value: abi.NewTokenAmount(4200), Method: builtin.MethodSend},
+	})
+	fc.Add(terminate)
+	fc.Add()
+
+	return fc
+}
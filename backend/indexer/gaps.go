@@ -0,0 +1,167 @@
+package indexer
+
+import (
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// Range is an inclusive range of epochs
+type Range struct {
+	From int64
+	To   int64
+}
+
+// recordRange marks the epochs from start to end as processed by handler, merging the stored ranges it
+// overlaps or touches into a single row
+func recordRange(db *gorm.DB, handler string, start, end int64) error {
+	var touching []orm.SyncedRange
+	if err := db.Where("handler = ? AND start_height <= ? AND end_height >= ?", handler, end+1, start-1).
+		Find(&touching).Error; err != nil {
+		return err
+	}
+
+	for _, r := range touching {
+		start = min(start, r.StartHeight)
+		end = max(end, r.EndHeight)
+	}
+
+	if len(touching) > 0 {
+		if err := db.Unscoped().Delete(&touching).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Create(&orm.SyncedRange{Handler: handler, StartHeight: start, EndHeight: end}).Error
+}
+
+// Gaps returns the ranges of epochs above minFetchHeight and up to the checkpoint of the handler name that
+// it never processed. A handler without checkpoint, only synced by reindexing, is checked up to the last
+// epoch it processed.
+func (i *Indexer) Gaps(name string) ([]Range, error) {
+	var checkpoints []orm.Checkpoint
+	if err := i.db.Where("handler = ?", name).Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+
+	var stored []orm.SyncedRange
+	if err := i.db.Where("handler = ?", name).Order("start_height").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	covered := make([]Range, 0, len(stored))
+	for _, r := range stored {
+		covered = append(covered, Range{From: r.StartHeight, To: r.EndHeight})
+	}
+
+	var top int64
+	if len(checkpoints) > 0 {
+		top = checkpoints[0].Height
+	} else if len(covered) > 0 {
+		top = covered[len(covered)-1].To
+	}
+
+	return missingRanges(covered, minFetchHeight+1, top), nil
+}
+
+// missingRanges returns the ranges between from and to that are not in covered, which must be sorted
+func missingRanges(covered []Range, from, to int64) []Range {
+	var missing []Range
+	next := from
+	for _, r := range covered {
+		if r.To < next {
+			continue
+		}
+
+		if r.From > to {
+			break
+		}
+
+		if r.From > next {
+			missing = append(missing, Range{From: next, To: r.From - 1})
+		}
+
+		next = r.To + 1
+	}
+
+	if next <= to {
+		missing = append(missing, Range{From: next, To: to})
+	}
+
+	return missing
+}
+
+// repairGaps re-syncs the gaps of the handlers, chaining passes as long as gaps are found and checking again
+// every RepairInterval once they are all filled
+func (i *Indexer) repairGaps() {
+	ticker := time.NewTicker(time.Duration(i.opts.RepairInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		found, err := i.repairPass()
+		if err != nil {
+			slog.Error("indexer gap repair error", "error", err)
+		}
+
+		if found && err == nil {
+			if i.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-i.ctx.Done():
+			return
+		}
+	}
+}
+
+// repairPass syncs at most rangeEpochNum epochs of the lowest gap of the first handler that has one and is
+// not being synced by another pass. It returns whether a gap was found.
+func (i *Indexer) repairPass() (bool, error) {
+	// a rollback must not happen while the pass commits, the repaired rows could end up above the fork
+	i.rollbackLk.RLock()
+	defer i.rollbackLk.RUnlock()
+
+	for _, handler := range i.handlers {
+		claimed := i.claim([]*Handler{handler})
+		if len(claimed) == 0 {
+			continue
+		}
+
+		found, err := i.repairHandler(handler)
+		i.release(claimed)
+		if found || err != nil {
+			return found, err
+		}
+	}
+
+	return false, nil
+}
+
+func (i *Indexer) repairHandler(handler *Handler) (bool, error) {
+	gaps, err := i.Gaps(handler.Name)
+	if err != nil || len(gaps) == 0 {
+		return false, err
+	}
+
+	start := gaps[0].From
+	end := min(gaps[0].To, start+rangeEpochNum-1)
+	slog.Warn("repairing gap", slog.String("handler", handler.Name), slog.Int64("startEpoch", start), slog.Int64("endEpoch", end))
+
+	// the gap is below the checkpoint, so every epoch of it is handled
+	return true, i.syncRange(start, end, []*Handler{handler}, map[string]int64{}, "", func(tx *Tx, start, end int64) error {
+		return i.db.Transaction(func(db *gorm.DB) error {
+			if err := tx.Flush(db); err != nil {
+				return err
+			}
+
+			return recordRange(db, handler.Name, start, end)
+		})
+	})
+}
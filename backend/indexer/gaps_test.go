@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		covered  []Range
+		from, to int64
+		want     []Range
+	}{
+		{name: "nothing covered", from: 1, to: 10, want: []Range{{1, 10}}},
+		{name: "fully covered", covered: []Range{{1, 10}}, from: 1, to: 10},
+		{name: "covered beyond bounds", covered: []Range{{0, 20}}, from: 1, to: 10},
+		{
+			name:    "holes",
+			covered: []Range{{1, 3}, {5, 5}, {8, 9}},
+			from:    1,
+			to:      12,
+			want:    []Range{{4, 4}, {6, 7}, {10, 12}},
+		},
+		{
+			name:    "ranges outside bounds",
+			covered: []Range{{-5, 0}, {4, 6}, {20, 30}},
+			from:    1,
+			to:      10,
+			want:    []Range{{1, 3}, {7, 10}},
+		},
+		{name: "empty bounds", covered: []Range{{1, 3}}, from: 5, to: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingRanges(tt.covered, tt.from, tt.to)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,518 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// rangeEpochNum is the number of epochs synced and committed in a single database transaction, it is
+// one day of epochs
+const rangeEpochNum = 2880
+
+// MsgHandler handles an executed message like chain.MsgHandler, rows are written through tx
+type MsgHandler func(tx *Tx, blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error
+
+// CallHandler handles a call like chain.CallHandler, rows are written through tx
+type CallHandler func(tx *Tx, blockMeta *chain.BlockMeta, call *chain.Call) error
+
+// TipSetHandler handles a tipset like chain.TipSetHandler, rows are written through tx
+type TipSetHandler func(tx *Tx, tipSetMeta *chain.TipSetMeta) error
+
+// EventHandler handles an actor event like chain.EventHandler, rows are written through tx
+type EventHandler func(tx *Tx, blockMeta *chain.BlockMeta, event *chain.Event) error
+
+// SampleHandler reads the state of the chain at a tipset through node, rows are written through tx. db holds
+// the rows committed so far, for handlers that sample the state of what other handlers indexed.
+type SampleHandler func(ctx context.Context, tx *Tx, db *gorm.DB, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) error
+
+// Handler is a named set of callbacks with its own checkpoint, so that it can be added, reset or removed
+// without re-syncing the other handlers
+type Handler struct {
+	// Name identifies the checkpoint of the handler, renaming a handler makes it sync again from the start
+	Name   string
+	Msg    MsgHandler
+	Call   CallHandler
+	Event  EventHandler
+	TipSet TipSetHandler
+	// Sample is called every Interval epochs with the tipset at the multiple of Interval, or the next one
+	// when that epoch is a null round
+	Sample   SampleHandler
+	Interval int64
+	// Filter selects the messages, calls and events passed to Msg, Call and Event, every tipset is passed
+	// to TipSet
+	Filter Filter
+	// NeedsTrace marks a handler of calls which only receives what it indexes from traced executions, it is
+	// refused when Options.Trace is off
+	NeedsTrace bool
+	// Models are the tables written by the handler, their rows above a fork are deleted on reorg and
+	// all of them are deleted when the handler is reset
+	Models []any
+}
+
+// initCheckpoints creates the checkpoints of the handlers that don't have one yet. On a database indexed
+// before checkpoints existed they start from the legacy chain height, otherwise from minFetchHeight. Handlers
+// without synced ranges get one up to their checkpoint.
+func (i *Indexer) initCheckpoints() error {
+	var count int64
+	if err := i.db.Model(&orm.Checkpoint{}).Count(&count).Error; err != nil {
+		return err
+	}
+
+	start := int64(minFetchHeight)
+	if count == 0 {
+		var legacy []orm.Chain
+		if err := i.db.Where("id = 1").Find(&legacy).Error; err != nil {
+			return err
+		}
+
+		if len(legacy) > 0 {
+			start = legacy[0].Height
+			slog.Info("initializing handler checkpoints from legacy chain height", slog.Int64("height", start))
+		}
+	}
+
+	for _, handler := range i.handlers {
+		var existing []orm.Checkpoint
+		if err := i.db.Where("handler = ?", handler.Name).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		height := start
+		if len(existing) > 0 {
+			height = existing[0].Height
+		} else if err := i.db.Create(&orm.Checkpoint{Handler: handler.Name, Height: start}).Error; err != nil {
+			return err
+		}
+
+		if err := seedSyncedRange(i.db, handler.Name, height); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedSyncedRange records the epochs up to the checkpoint height of a handler without synced ranges as
+// processed. They were indexed before ranges were recorded, gap repair would otherwise sync them again.
+func seedSyncedRange(db *gorm.DB, handler string, height int64) error {
+	if height <= minFetchHeight {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&orm.SyncedRange{}).Where("handler = ?", handler).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	slog.Info("seeding synced range of handler indexed before ranges were recorded", slog.String("handler", handler), slog.Int64("height", height))
+	return recordRange(db, handler, minFetchHeight+1, height)
+}
+
+// checkHandlers returns an error when one of handlers can't index anything with the options of the indexer
+func (i *Indexer) checkHandlers(handlers []*Handler) error {
+	for _, handler := range handlers {
+		if handler.NeedsTrace && !i.opts.Trace {
+			return fmt.Errorf("handler %s needs traced calls, tracing is disabled", handler.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkpoints returns the checkpoint of every registered handler
+func (i *Indexer) checkpoints() (map[string]int64, error) {
+	var rows []orm.Checkpoint
+	if err := i.db.Where("handler IN ?", handlerNames(i.handlers)).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	checkpoints := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		checkpoints[row.Handler] = row.Height
+	}
+
+	for _, handler := range i.handlers {
+		if _, ok := checkpoints[handler.Name]; !ok {
+			return nil, fmt.Errorf("no checkpoint for handler %s", handler.Name)
+		}
+	}
+
+	return checkpoints, nil
+}
+
+// ResetHandler deletes every row written by the registered handler name and its synced ranges, and moves its
+// checkpoint back to minFetchHeight, the handler then syncs again from there while the other handlers keep their
+// progress. Tables another registered handler also writes are left as they are, the rows the handler writes again
+// replace its own. It must be called before Start.
+func (i *Indexer) ResetHandler(name string) error {
+	handler, err := i.handler(name)
+	if err != nil {
+		return err
+	}
+
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range handler.Models {
+			if owner := i.sharedModel(model, handler); owner != "" {
+				slog.Warn("keeping rows of a table shared with another handler", slog.String("handler", name), slog.String("shared", owner))
+				continue
+			}
+
+			if err := tx.Unscoped().Where("1 = 1").Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("handler = ?", name).Delete(&orm.SyncedRange{}).Error; err != nil {
+			return err
+		}
+
+		// the checkpoint is set explicitly, a missing one could be initialized from the legacy chain height
+		if err := tx.Unscoped().Where("handler = ?", name).Delete(&orm.Checkpoint{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&orm.Checkpoint{Handler: name, Height: minFetchHeight}).Error
+	})
+}
+
+// sharedModel returns the name of a registered handler other than handlers that also writes the table of model,
+// or an empty string when only handlers write it
+func (i *Indexer) sharedModel(model any, handlers ...*Handler) string {
+	typ := reflect.TypeOf(model)
+	for _, other := range i.handlers {
+		if slices.Contains(handlers, other) {
+			continue
+		}
+
+		for _, m := range other.Models {
+			if reflect.TypeOf(m) == typ {
+				return other.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// claim marks the handlers as being synced and returns the ones that were not already claimed by
+// another pass, they must be released once the pass is over
+func (i *Indexer) claim(handlers []*Handler) []*Handler {
+	i.lk.Lock()
+	defer i.lk.Unlock()
+
+	var claimed []*Handler
+	for _, handler := range handlers {
+		if i.busy[handler.Name] {
+			continue
+		}
+
+		i.busy[handler.Name] = true
+		claimed = append(claimed, handler)
+	}
+
+	return claimed
+}
+
+func (i *Indexer) release(handlers []*Handler) {
+	i.lk.Lock()
+	defer i.lk.Unlock()
+
+	for _, handler := range handlers {
+		delete(i.busy, handler.Name)
+	}
+}
+
+// catchUp runs catch-up passes for the handlers behind the others every Interval, so that a newly
+// registered or reset handler backfills its history while the up-to-date handlers keep following the tip
+func (i *Indexer) catchUp() {
+	ticker := time.NewTicker(time.Duration(i.opts.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		// passes are chained without waiting as long as some handler is behind
+		behind, err := i.catchUpPass()
+		if err != nil {
+			slog.Error("indexer catch-up error", "error", err)
+		}
+
+		if behind && err == nil {
+			if i.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-i.ctx.Done():
+			return
+		}
+	}
+}
+
+// catchUpPass syncs at most rangeEpochNum epochs for the handlers whose checkpoint is below the tip, the
+// highest checkpoint of all handlers. It returns whether any handler was behind.
+func (i *Indexer) catchUpPass() (bool, error) {
+	// a rollback must not happen while the pass commits checkpoints, they could end up above the fork
+	i.rollbackLk.RLock()
+	defer i.rollbackLk.RUnlock()
+
+	checkpoints, err := i.checkpoints()
+	if err != nil {
+		return false, err
+	}
+
+	tip := tipHeight(checkpoints)
+
+	var behind []*Handler
+	for _, handler := range i.handlers {
+		if checkpoints[handler.Name] < tip {
+			behind = append(behind, handler)
+		}
+	}
+
+	behind = i.claim(behind)
+	if len(behind) == 0 {
+		return false, nil
+	}
+	defer i.release(behind)
+
+	start := tip
+	for _, handler := range behind {
+		start = min(start, checkpoints[handler.Name])
+	}
+	start++
+	end := min(start+rangeEpochNum-1, tip)
+
+	slog.Info("catching up handlers", slog.Any("handlers", handlerNames(behind)), slog.Int64("startEpoch", start), slog.Int64("endEpoch", end))
+
+	// the tipsets of the range were recorded when the tip passed them
+	return true, i.syncRange(start, end, behind, checkpoints, "", i.checkpointCommitter(behind, checkpoints))
+}
+
+// committer applies the rows written while syncing the range from start to end
+type committer func(tx *Tx, start, end int64) error
+
+// syncRange syncs the epochs from start to end for handlers in ranges of at most rangeEpochNum epochs, each
+// applied by commit once synced. Every handler only receives the epochs above its checkpoint. Tipsets and null
+// rounds are recorded with finality unless it is empty.
+func (i *Indexer) syncRange(start, end int64, handlers []*Handler, checkpoints map[string]int64, finality string, commit committer) error {
+	var msgHandlers, callHandlers, eventHandlers, tipSetHandlers, sampleHandlers []*Handler
+	for _, handler := range handlers {
+		if handler.Msg != nil {
+			msgHandlers = append(msgHandlers, handler)
+		}
+
+		if handler.Call != nil {
+			callHandlers = append(callHandlers, handler)
+		}
+
+		if handler.Event != nil {
+			eventHandlers = append(eventHandlers, handler)
+		}
+
+		if handler.TipSet != nil {
+			tipSetHandlers = append(tipSetHandlers, handler)
+		}
+
+		if handler.Sample != nil {
+			sampleHandlers = append(sampleHandlers, handler)
+		}
+	}
+
+	// prev is the height of the tipset before the one delivered, it is looked up for the first tipset
+	prev := int64(-1)
+
+	for ; start <= end; start += rangeEpochNum {
+		rangeEnd := min(start+rangeEpochNum-1, end)
+		tx := NewTx()
+		tx.syncing = handlerNames(handlers)
+
+		var msgHandler chain.MsgHandler
+		if len(msgHandlers) > 0 {
+			msgHandler = func(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+				for _, handler := range msgHandlers {
+					if blockMeta.Height <= checkpoints[handler.Name] {
+						continue
+					}
+					if ok, err := handler.Filter.match(msg.From, msg.To, msg.Method, msg.Value, i.actorName(blockMeta.TipSet)); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					} else if !ok {
+						continue
+					}
+
+					if err := handler.Msg(tx, blockMeta, msg, receipt); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					}
+				}
+				return nil
+			}
+		}
+
+		opts := []chain.SyncOption{chain.WithConcurrency(i.opts.Concurrency), chain.WithRetries(i.opts.Retries), chain.WithTrace(i.opts.Trace)}
+		if len(callHandlers) > 0 {
+			opts = append(opts, chain.WithCallHandler(func(blockMeta *chain.BlockMeta, call *chain.Call) error {
+				for _, handler := range callHandlers {
+					if blockMeta.Height <= checkpoints[handler.Name] {
+						continue
+					}
+					if ok, err := handler.Filter.match(call.From, call.To, call.Method, call.Value, i.actorName(blockMeta.TipSet)); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					} else if !ok {
+						continue
+					}
+
+					if err := handler.Call(tx, blockMeta, call); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					}
+				}
+				return nil
+			}))
+		}
+
+		if len(eventHandlers) > 0 {
+			opts = append(opts, chain.WithEventHandler(func(blockMeta *chain.BlockMeta, event *chain.Event) error {
+				for _, handler := range eventHandlers {
+					if blockMeta.Height <= checkpoints[handler.Name] || !handler.Filter.matchEvent(event) {
+						continue
+					}
+
+					if err := handler.Event(tx, blockMeta, event); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					}
+				}
+				return nil
+			}))
+		}
+
+		if finality != "" || len(tipSetHandlers) > 0 || len(sampleHandlers) > 0 {
+			opts = append(opts, chain.WithTipSetHandler(func(tipSetMeta *chain.TipSetMeta) error {
+				if finality != "" {
+					tx.Upsert(&orm.TipSet{
+						Height:    tipSetMeta.Height,
+						Key:       tipSetMeta.Key.String(),
+						ParentKey: tipSetMeta.Parents.String(),
+						Finality:  finality,
+					})
+				}
+
+				for _, handler := range tipSetHandlers {
+					if tipSetMeta.Height <= checkpoints[handler.Name] {
+						continue
+					}
+
+					if err := handler.TipSet(tx, tipSetMeta); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					}
+				}
+
+				if len(sampleHandlers) > 0 && prev < 0 {
+					parent, err := i.node.ChainGetTipSetByHeight(i.ctx, abi.ChainEpoch(tipSetMeta.Height-1), tipSetMeta.Key)
+					if err != nil {
+						return fmt.Errorf("get parent of tipset at epoch %d: %w", tipSetMeta.Height, err)
+					}
+					prev = int64(parent.Height())
+				}
+
+				for _, handler := range sampleHandlers {
+					if tipSetMeta.Height <= checkpoints[handler.Name] || !sampleDue(tipSetMeta.Height, prev, handler.Interval) {
+						continue
+					}
+
+					if err := handler.Sample(i.ctx, tx, i.db, i.node, tipSetMeta); err != nil {
+						return fmt.Errorf("handler %s: %w", handler.Name, err)
+					}
+				}
+
+				prev = tipSetMeta.Height
+				return nil
+			}))
+		}
+
+		if finality != "" {
+			opts = append(opts, chain.WithNullRoundHandler(func(epoch int64, timestamp int64) error {
+				// recorded so that per-epoch statistics can account for epochs without blocks
+				tx.Upsert(&orm.NullRound{
+					Height:    epoch,
+					Timestamp: timestamp,
+				})
+				return nil
+			}))
+		}
+
+		if err := i.node.SyncBlocks(start, rangeEnd, msgHandler, opts...); err != nil {
+			return err
+		}
+
+		if err := commit(tx, start, rangeEnd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkpointCommitter writes the rows of a range, moves the checkpoints of handlers up to its end and records
+// the epochs each handler processed, the ones above its checkpoint, in one transaction
+func (i *Indexer) checkpointCommitter(handlers []*Handler, checkpoints map[string]int64) committer {
+	return func(tx *Tx, start, end int64) error {
+		return i.db.Transaction(func(db *gorm.DB) error {
+			if err := tx.Flush(db); err != nil {
+				return err
+			}
+
+			if err := db.Model(&orm.Checkpoint{}).
+				Where("handler IN ? AND height < ?", handlerNames(handlers), end).
+				Update("height", end).Error; err != nil {
+				return err
+			}
+
+			for _, handler := range handlers {
+				if err := recordRange(db, handler.Name, max(start, checkpoints[handler.Name]+1), end); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+}
+
+// sampleDue reports whether the tipset at height is the first one at or after a multiple of interval, prev
+// being the height of the tipset before it
+func sampleDue(height, prev, interval int64) bool {
+	return height/interval*interval > prev
+}
+
+func handlerNames(handlers []*Handler) []string {
+	names := make([]string, 0, len(handlers))
+	for _, handler := range handlers {
+		names = append(names, handler.Name)
+	}
+
+	return names
+}
+
+// tipHeight returns the highest checkpoint, the handlers at it follow the chain head
+func tipHeight(checkpoints map[string]int64) int64 {
+	var tip int64
+	for _, height := range checkpoints {
+		tip = max(tip, height)
+	}
+
+	return tip
+}
@@ -0,0 +1,164 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestResetHandler(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// the legacy chain height is only used for databases without any checkpoint
+	if err := db.Create(&orm.Chain{Model: gorm.Model{ID: 1}, Height: 5_300_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	owner := &Handler{Name: "owner", Models: []any{&orm.Miner{}, &orm.ChainStat{}}}
+	shared := &Handler{Name: "shared", Models: []any{&orm.Miner{}}}
+	if err := db.Create(&orm.Miner{MinerID: "f01000", Height: 5_300_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&orm.ChainStat{Height: 5_300_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := recordRange(db, owner.Name, minFetchHeight+1, 5_300_000); err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIndexer(ctx, Options{}, chain.NewNodeFromSource(ctx, chaintest.NewChain(100)), db, owner, shared)
+	if err := i.ResetHandler(owner.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.initCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints, err := i.checkpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoints[owner.Name] != minFetchHeight {
+		t.Fatalf("expected the reset handler to restart from %d, got %d", minFetchHeight, checkpoints[owner.Name])
+	}
+
+	var stats, miners, ranges int64
+	db.Model(&orm.ChainStat{}).Count(&stats)
+	db.Model(&orm.Miner{}).Count(&miners)
+	db.Model(&orm.SyncedRange{}).Where("handler = ?", owner.Name).Count(&ranges)
+	if stats != 0 || ranges != 0 {
+		t.Fatalf("expected the rows and ranges of the handler to be deleted, got %d rows and %d ranges", stats, ranges)
+	}
+	if miners != 1 {
+		t.Fatalf("expected the table shared with another handler to be kept, got %d rows", miners)
+	}
+}
+
+func TestInitCheckpointsSeedsSyncedRanges(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if err := db.Create(&orm.Chain{Model: gorm.Model{ID: 1}, Height: 5_300_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIndexer(ctx, Options{}, chain.NewNodeFromSource(ctx, chaintest.NewChain(100)), db, &Handler{Name: "legacy"})
+	if err := i.initCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a handler indexed before ranges were recorded
+	if err := db.Create(&orm.Checkpoint{Handler: "checkpointed", Height: 5_250_000}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// a handler added later starts from minFetchHeight with nothing synced yet
+	i = NewIndexer(ctx, Options{}, chain.NewNodeFromSource(ctx, chaintest.NewChain(100)), db,
+		&Handler{Name: "legacy"}, &Handler{Name: "checkpointed"}, &Handler{Name: "new"})
+	if err := i.initCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, height := range map[string]int64{"legacy": 5_300_000, "checkpointed": 5_250_000, "new": minFetchHeight} {
+		gaps, err := i.Gaps(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gaps) != 0 {
+			t.Errorf("%s: expected no gaps up to %d, got %v", name, height, gaps)
+		}
+	}
+
+	var ranges int64
+	db.Model(&orm.SyncedRange{}).Count(&ranges)
+	if ranges != 2 {
+		t.Fatalf("expected 2 seeded ranges, got %d", ranges)
+	}
+}
+
+func TestSampleDue(t *testing.T) {
+	for _, tt := range []struct {
+		height, prev, interval int64
+		want                   bool
+	}{
+		{height: 102, prev: 101, interval: 2, want: true},
+		{height: 103, prev: 102, interval: 2},
+		// 104 is a null round, the next tipset is sampled instead
+		{height: 105, prev: 103, interval: 2, want: true},
+		{height: 106, prev: 105, interval: 3},
+		// several multiples skipped by null rounds only give one sample
+		{height: 110, prev: 105, interval: 2, want: true},
+		{height: 2880, prev: 2879, interval: 2880, want: true},
+		{height: 2881, prev: 2880, interval: 2880},
+	} {
+		if got := sampleDue(tt.height, tt.prev, tt.interval); got != tt.want {
+			t.Errorf("sampleDue(%d, %d, %d): expected %v, got %v", tt.height, tt.prev, tt.interval, tt.want, got)
+		}
+	}
+}
+
+func TestSampleSchedule(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+	fc.Add()
+	fc.NullRounds(1)
+	fc.Add()
+	fc.Add()
+	fc.Add()
+
+	var heights []int64
+	handler := &Handler{
+		Name: "sample",
+		Sample: func(_ context.Context, _ *Tx, _ *gorm.DB, _ chain.ChainSource, tipSetMeta *chain.TipSetMeta) error {
+			heights = append(heights, tipSetMeta.Height)
+			return nil
+		},
+		Interval: 2,
+	}
+
+	i := NewIndexer(ctx, Options{}, chain.NewNodeFromSource(ctx, fc), nil, handler)
+	discard := func(*Tx, int64, int64) error { return nil }
+
+	if err := i.syncRange(101, 106, i.handlers, map[string]int64{}, "", discard); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 3 || heights[0] != 102 || heights[1] != 105 || heights[2] != 106 {
+		t.Fatalf("expected samples at 102, 105 and 106, got %v", heights)
+	}
+
+	// a range starting right after a null round looks up the tipset before it
+	heights = nil
+	if err := i.syncRange(105, 105, i.handlers, map[string]int64{}, "", discard); err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 1 || heights[0] != 105 {
+		t.Fatalf("expected a sample at 105, got %v", heights)
+	}
+}
@@ -2,10 +2,16 @@ package indexer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
-	"github.com/filecoin-project/venus/venus-shared/actors/types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"gorm.io/gorm"
 
 	"github.com/ipfs-force-community/janus/chain"
@@ -15,28 +21,104 @@ import (
 const (
 	minFetchHeight = 5200000
 	safeConfirmNum = 20
+	// maxReorgDepth bounds how far back the indexer looks for a common ancestor, it matches
+	// the EC finality of the Filecoin network
+	maxReorgDepth = 900
 )
 
+// chainModels lists the tables written by the indexer itself while following the tip, they are rolled
+// back on reorg together with the models of the handlers
+var chainModels = []any{&orm.TipSet{}, &orm.NullRound{}}
+
+// Options configures the Indexer
+type Options struct {
+	// Interval is the number of seconds between two sync runs
+	Interval int64
+	// ConfirmDepth is the number of epochs to stay behind the head when F3 finality is unavailable
+	ConfirmDepth int64
+	// Concurrency limits the number of epochs fetched from the node in parallel
+	Concurrency int
+	// Retries is the number of times fetching an epoch is retried after a transient error
+	Retries int
+	// Trace replays tipset execution so that call handlers also receive internal calls
+	Trace bool
+	// Live syncs on head changes pushed by the node instead of polling every Interval
+	Live bool
+	// RepairInterval is the number of seconds between two searches for gaps in the epochs processed by the
+	// handlers, gaps are not repaired when it is 0
+	RepairInterval int64
+	// DryRun makes Reindex discard the rows of every range instead of replacing the indexed ones
+	DryRun bool
+}
+
 type Indexer struct {
-	ctx         context.Context
-	interval    int64
-	node        *chain.Node
-	db          *gorm.DB
-	msgHandlers []chain.MsgHandler
+	ctx      context.Context
+	opts     Options
+	node     *chain.Node
+	db       *gorm.DB
+	handlers []*Handler
+
+	// busy holds the handlers a sync pass is running for, so that the follow and catch-up passes
+	// never run the same handler concurrently
+	lk   sync.Mutex
+	busy map[string]bool
+	// rollbackLk is held by catch-up passes and taken exclusively to roll back a reorg
+	rollbackLk sync.RWMutex
+
+	actorNames *lru.Cache[actorKey, string]
 }
 
-func NewIndexer(ctx context.Context, interval int64, node *chain.Node, db *gorm.DB, msgHandlers ...chain.MsgHandler) *Indexer {
+func NewIndexer(ctx context.Context, opts Options, node *chain.Node, db *gorm.DB, handlers ...*Handler) *Indexer {
+	if opts.ConfirmDepth < 0 {
+		opts.ConfirmDepth = safeConfirmNum
+	}
+
+	actorNames, _ := lru.New[actorKey, string](actorNameCacheSize)
+
 	return &Indexer{
-		ctx:         ctx,
-		interval:    interval,
-		node:        node,
-		db:          db,
-		msgHandlers: msgHandlers,
+		ctx:        ctx,
+		opts:       opts,
+		node:       node,
+		db:         db,
+		handlers:   handlers,
+		busy:       make(map[string]bool),
+		actorNames: actorNames,
 	}
 }
 
 func (i *Indexer) Start() {
-	ticker := time.NewTicker(time.Duration(i.interval) * time.Second)
+	if err := i.checkHandlers(i.handlers); err != nil {
+		slog.Error("invalid handlers", "error", err)
+		return
+	}
+
+	if err := i.initCheckpoints(); err != nil {
+		slog.Error("failed to initialize handler checkpoints", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		i.catchUp()
+	}()
+
+	if i.opts.RepairInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.repairGaps()
+		}()
+	}
+	defer wg.Wait()
+
+	if i.opts.Live {
+		i.follow()
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(i.opts.Interval) * time.Second)
 	defer ticker.Stop()
 
 	for {
@@ -53,59 +135,152 @@ func (i *Indexer) Start() {
 	}
 }
 
+// sync runs a follow pass: after rolling back any reorg it syncs the handlers at the tip, the highest
+// checkpoint, up to the finalized height. Handlers behind the tip are left to the catch-up passes.
 func (i *Indexer) sync() error {
-	latestHeight, err := i.localHeight()
+	checkpoints, err := i.checkpoints()
+	if err != nil {
+		return err
+	}
+
+	tip := tipHeight(checkpoints)
+
+	// get the current chain head
+	head, err := i.node.ChainHead(i.ctx)
 	if err != nil {
 		return err
 	}
 
-	// get the current chain head height
-	headHeight, err := i.node.ChainHeadHeight()
+	// roll back everything indexed above the fork point if the stored tipsets are no longer canonical
+	forkHeight, err := i.findForkHeight(head, tip)
 	if err != nil {
 		return err
 	}
 
-	// only sync up to headHeight - safeConfirmNum to avoid chain reorg issues
-	headHeight -= safeConfirmNum
-	if latestHeight >= headHeight {
+	if forkHeight < tip {
+		slog.Warn("chain reorg detected, rolling back", slog.Int64("from", tip), slog.Int64("to", forkHeight))
+		if err := i.rollback(forkHeight); err != nil {
+			return err
+		}
+
+		// the catch-up passes may have moved checkpoints while waiting for the rollback
+		if checkpoints, err = i.checkpoints(); err != nil {
+			return err
+		}
+		tip = tipHeight(checkpoints)
+	}
+
+	headHeight, finality := i.finalizedHeight(head)
+	if tip >= headHeight {
 		return nil
 	}
 
-	if err := i.node.SyncBlocks(latestHeight+1, headHeight, func(blockMeta *chain.BlockMeta, msg *types.Message) error {
-		for _, handle := range i.msgHandlers {
-			if err := handle(blockMeta, msg); err != nil {
-				return err
-			}
+	var following []*Handler
+	for _, handler := range i.handlers {
+		if checkpoints[handler.Name] == tip {
+			following = append(following, handler)
 		}
+	}
+
+	following = i.claim(following)
+	if len(following) == 0 {
 		return nil
-	}); err != nil {
-		return err
 	}
+	defer i.release(following)
 
-	// update the latest synced height in the database
-	if err := i.db.Model(&orm.Chain{}).Where("id = 1").Update("height", headHeight).Error; err != nil {
-		return err
+	return i.syncRange(tip+1, headHeight, following, checkpoints, finality, i.checkpointCommitter(following, checkpoints))
+}
+
+// finalizedHeight returns the height the indexer may advance to and the finality rule that allowed it.
+// The latest F3 finalized tipset is used when F3 is running, otherwise the indexer stays ConfirmDepth
+// epochs behind the head and relies on reorg detection. The head itself is never returned, its messages are
+// not executed yet.
+func (i *Indexer) finalizedHeight(head *types.TipSet) (int64, string) {
+	ecHeight := int64(head.Height()) - max(i.opts.ConfirmDepth, 1)
+
+	f3Height, err := i.node.F3FinalizedHeight()
+	if err != nil {
+		slog.Debug("f3 finality unavailable, falling back to ec", "error", err)
+		return ecHeight, orm.FinalityEC
+	}
+
+	// a stalled F3 instance must not hold the indexer further back than the EC rule does
+	if f3Height < ecHeight {
+		return ecHeight, orm.FinalityEC
 	}
 
-	return nil
+	// the messages of the head are not executed yet, so it is never synced
+	return min(f3Height, int64(head.Height())-1), orm.FinalityF3
 }
 
-func (i *Indexer) localHeight() (int64, error) {
-	var latestChain orm.Chain
-	if err := i.db.First(&latestChain).Error; err != nil && err != gorm.ErrRecordNotFound {
+// findForkHeight checks that the first tipset above latestHeight builds on the last stored tipset.
+// If it doesn't, it walks the stored tipsets back until one is found on the canonical chain of head
+// and returns its height, otherwise latestHeight is returned unchanged.
+func (i *Indexer) findForkHeight(head *types.TipSet, latestHeight int64) (int64, error) {
+	var stored []orm.TipSet
+	if err := i.db.Where("height <= ?", latestHeight).
+		Order("height DESC").
+		Limit(maxReorgDepth).
+		Find(&stored).Error; err != nil {
 		return 0, err
-	} else if err == gorm.ErrRecordNotFound {
-		// If no record found, initialize the height to minFetchHeight
-		if err := i.db.Create(&orm.Chain{
-			Height: minFetchHeight,
-		}).Error; err != nil {
-			return 0, err
+	}
+
+	// nothing recorded yet, there is nothing to compare with
+	if len(stored) == 0 || int64(head.Height()) <= latestHeight {
+		return latestHeight, nil
+	}
+
+	next, err := i.node.ChainGetTipSetAfterHeight(i.ctx, abi.ChainEpoch(latestHeight+1), head.Key())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tipset after epoch %d: %w", latestHeight, err)
+	}
+
+	if next.Parents().String() == stored[0].Key {
+		return latestHeight, nil
+	}
+
+	for _, ts := range stored {
+		canonical, err := i.node.ChainGetTipSetByHeight(i.ctx, abi.ChainEpoch(ts.Height), head.Key())
+		if err != nil {
+			return 0, fmt.Errorf("failed to get tipset at epoch %d: %w", ts.Height, err)
+		}
+
+		if int64(canonical.Height()) == ts.Height && canonical.Key().String() == ts.Key {
+			return ts.Height, nil
 		}
+	}
 
-		return minFetchHeight, nil
+	return 0, errors.New("no common ancestor found within max reorg depth")
+}
+
+// rollback removes all rows written by the indexer and its handlers above height, moves the checkpoints
+// above it back to height and trims the synced ranges accordingly
+func (i *Indexer) rollback(height int64) error {
+	i.rollbackLk.Lock()
+	defer i.rollbackLk.Unlock()
+
+	models := slices.Clone(chainModels)
+	for _, handler := range i.handlers {
+		models = append(models, handler.Models...)
 	}
 
-	return latestChain.Height, nil
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range models {
+			if err := tx.Unscoped().Where("height > ?", height).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("start_height > ?", height).Delete(&orm.SyncedRange{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&orm.SyncedRange{}).Where("end_height > ?", height).Update("end_height", height).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&orm.Checkpoint{}).Where("height > ?", height).Update("height", height).Error
+	})
 }
 
 func (i *Indexer) Close() error {
@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestFinalizedHeight(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	for range 30 {
+		fc.Add()
+	}
+	head := fc.Add()
+
+	for _, tt := range []struct {
+		confirmDepth int64
+		want         int64
+	}{
+		{confirmDepth: 20, want: 111},
+		// the head is never synced, even without confirmations
+		{confirmDepth: 0, want: 130},
+	} {
+		i := NewIndexer(ctx, Options{ConfirmDepth: tt.confirmDepth}, chain.NewNodeFromSource(ctx, fc), nil)
+		if height, finality := i.finalizedHeight(head); height != tt.want || finality != orm.FinalityEC {
+			t.Errorf("confirm depth %d: expected %d with ec, got %d with %s", tt.confirmDepth, tt.want, height, finality)
+		}
+	}
+
+	// F3 finalizes up to the tipset below the head at most
+	fc.SetF3Finalized(131)
+	i := NewIndexer(ctx, Options{ConfirmDepth: 20}, chain.NewNodeFromSource(ctx, fc), nil)
+	if height, finality := i.finalizedHeight(head); height != 130 || finality != orm.FinalityF3 {
+		t.Errorf("expected 130 with f3, got %d with %s", height, finality)
+	}
+}
+
+// newTestDB returns an empty in-memory database with the tables of the indexer and of every registered
+// handler
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the in-memory database is dropped with its last connection
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	models := []any{&orm.Miner{}, &orm.Chain{}, &orm.Checkpoint{}, &orm.SyncedRange{}, &orm.TipSet{}, &orm.NullRound{}}
+	for _, name := range RegisteredHandlers() {
+		models = append(models, registry[name]().Models...)
+	}
+
+	if err := orm.AutoMigrate(db, models...); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
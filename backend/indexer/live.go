@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 2 * time.Minute
+)
+
+// follow syncs whenever the node pushes a head change. While the subscription is down it falls back to
+// polling every Interval and tries to subscribe again with an exponential backoff, which is only reset once
+// a subscription delivered a head change, so that one closing right away is not retried in a tight loop.
+func (i *Indexer) follow() {
+	backoff := minReconnectBackoff
+	for {
+		notifs, err := i.node.ChainNotify(i.ctx)
+		if err != nil {
+			slog.Error("subscribe to head changes failed, polling until reconnected", "error", err, "retryIn", backoff)
+		} else {
+			slog.Info("subscribed to head changes")
+
+			received, ok := i.consume(notifs)
+			if !ok {
+				slog.Info("indexer context done, exiting...")
+				return
+			}
+
+			if received {
+				backoff = minReconnectBackoff
+			}
+
+			slog.Warn("head change subscription closed, polling until reconnected", "retryIn", backoff)
+		}
+
+		if !i.pollFor(backoff) {
+			slog.Info("indexer context done, exiting...")
+			return
+		}
+
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// consume syncs on every batch of head changes until notifs is closed, the first sync also fills any gap
+// left while the indexer was disconnected. It returns whether a head change was received, the current head
+// sent on subscription aside, and false as second value when the indexer context is done.
+func (i *Indexer) consume(notifs <-chan []*types.HeadChange) (bool, bool) {
+	// changes are drained in a separate goroutine so a slow sync never blocks the subscription,
+	// pending triggers are coalesced into a single sync
+	trigger := make(chan struct{}, 1)
+	trigger <- struct{}{}
+	closed := make(chan struct{})
+	var received atomic.Bool
+	go func() {
+		defer close(closed)
+		for changes := range notifs {
+			for _, change := range changes {
+				if change.Type != types.HCCurrent {
+					received.Store(true)
+				}
+
+				if change.Type == types.HCRevert {
+					slog.Warn("head change reverted tipset", slog.Int64("height", int64(change.Val.Height())))
+				}
+			}
+
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-trigger:
+			// reverted tipsets that were already indexed are rolled back by the reorg check of sync
+			if err := i.sync(); err != nil {
+				slog.Error("indexer sync error", "error", err)
+			}
+
+		case <-closed:
+			return received.Load(), true
+
+		case <-i.ctx.Done():
+			return received.Load(), false
+		}
+	}
+}
+
+// pollFor syncs right away then every Interval during d, it returns false when the indexer context is done
+func (i *Indexer) pollFor(d time.Duration) bool {
+	deadline := time.NewTimer(d)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(time.Duration(i.opts.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := i.sync(); err != nil {
+			slog.Error("indexer sync error", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return true
+		case <-i.ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// waitForHeight waits until the chain_stats handler indexed the tipset at height
+func waitForHeight(t *testing.T, db *gorm.DB, height int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var count int64
+		if err := db.Model(&orm.ChainStat{}).Where("height = ?", height).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("epoch %d was not indexed", height)
+}
+
+func TestFollow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fc := chaintest.NewChain(minFetchHeight)
+	fc.Add()
+	fc.Add()
+
+	db := newTestDB(t)
+	i := NewIndexer(ctx, Options{Interval: 1, ConfirmDepth: 1, Live: true}, chain.NewNodeFromSource(ctx, fc), db, newChainStatsHandler())
+	if err := i.initCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		i.follow()
+	}()
+
+	// the first sync of a subscription catches up to the head
+	waitForHeight(t, db, minFetchHeight+1)
+
+	fc.Add()
+	waitForHeight(t, db, minFetchHeight+2)
+
+	// the indexer keeps following once the subscription dropped
+	fc.CloseNotify()
+	fc.Add()
+	waitForHeight(t, db, minFetchHeight+3)
+	fc.Add()
+	waitForHeight(t, db, minFetchHeight+4)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not exit with its context")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(minFetchHeight)
+	fc.Add()
+	head := fc.Add()
+
+	db := newTestDB(t)
+	i := NewIndexer(ctx, Options{Interval: 1, ConfirmDepth: 1}, chain.NewNodeFromSource(ctx, fc), db, newChainStatsHandler())
+	if err := i.initCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a subscription closing right after the current head did not deliver any change
+	notifs := make(chan []*types.HeadChange, 1)
+	notifs <- []*types.HeadChange{{Type: types.HCCurrent, Val: head}}
+	close(notifs)
+
+	received, ok := i.consume(notifs)
+	if received || !ok {
+		t.Errorf("expected no change received, got %v, %v", received, ok)
+	}
+
+	notifs = make(chan []*types.HeadChange, 2)
+	notifs <- []*types.HeadChange{{Type: types.HCCurrent, Val: head}}
+	notifs <- []*types.HeadChange{{Type: types.HCApply, Val: head}}
+	close(notifs)
+
+	if received, ok := i.consume(notifs); !received || !ok {
+		t.Errorf("expected a change received, got %v, %v", received, ok)
+	}
+}
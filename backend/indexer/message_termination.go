@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func init() {
+	RegisterOptional(newMessageTerminationsHandler)
+}
+
+// newMessageTerminationsHandler returns the handler indexing the termination fees paid by miners in
+// TerminateSectors messages in the message_terminations table. The receipt of TerminateSectors only tells
+// whether all the sectors were terminated, the fee is the value the miner sends to the burnt funds actor while
+// executing it, so the handler needs traced calls. Cron burns termination fees together with other penalties,
+// so the terminations it runs are left out.
+func newMessageTerminationsHandler() *Handler {
+	return &Handler{
+		Name: "message_terminations",
+		Call: func(tx *Tx, blockMeta *chain.BlockMeta, call *chain.Call) error {
+			if record := NewMessageTerminationRecord(blockMeta, call); record != nil {
+				// a fee is identified by its message and call index, indexing it again replaces the row
+				tx.Upsert(record)
+			}
+			return nil
+		},
+		Filter: Filter{
+			To:         []address.Address{builtin.BurntFundsActorAddr},
+			FromActors: []string{"storageminer"},
+		},
+		NeedsTrace: true,
+		Models:     []any{&orm.MessageTermination{}},
+	}
+}
+
+// NewMessageTerminationRecord creates a row from a call burning funds sent by a miner actor, it returns nil
+// unless the call is the termination fee the miner paid in a TerminateSectors call to itself that succeeded
+func NewMessageTerminationRecord(blockMeta *chain.BlockMeta, call *chain.Call) *orm.MessageTermination {
+	parent := call.Parent
+	if parent == nil || parent.To != call.From || parent.Method != builtin.MethodsMiner.TerminateSectors {
+		return nil
+	}
+
+	// the burn is reverted when any call up to the message fails
+	for c := call; c != nil; c = c.Parent {
+		if !c.ExitCode.IsSuccess() {
+			return nil
+		}
+	}
+
+	record := &orm.MessageTermination{
+		Height:    blockMeta.Height,
+		Cid:       blockMeta.Cid.String(),
+		Timestamp: blockMeta.Timestamp,
+		MsgCid:    call.MsgCid.String(),
+		CallIndex: call.Index,
+		Miner:     call.From.String(),
+		Fee:       call.Value.String(),
+	}
+
+	var params miner.TerminateSectorsParams
+	if err := decodeParams(parent.Params, &params); err == nil {
+		for _, termination := range params.Terminations {
+			if n, err := termination.Sectors.Count(); err == nil {
+				record.DeclaredSectors += int64(n)
+			}
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/ipfs-force-community/janus/chain"
+)
+
+func TestNewMessageTerminationRecord(t *testing.T) {
+	minerAddr, _ := address.NewIDAddress(1000)
+	msgCid, _ := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte("terminate"))
+	blockMeta := &chain.BlockMeta{Height: 100, Cid: msgCid, Timestamp: 3000}
+
+	var params bytes.Buffer
+	if err := (&miner.TerminateSectorsParams{Terminations: []miner.TerminationDeclaration{
+		{Deadline: 1, Sectors: bitfield.NewFromSet([]uint64{1, 2})},
+		{Deadline: 2, Sectors: bitfield.NewFromSet([]uint64{9})},
+	}}).MarshalCBOR(&params); err != nil {
+		t.Fatal(err)
+	}
+
+	terminate := &chain.Call{MsgCid: msgCid, To: minerAddr, Method: builtin.MethodsMiner.TerminateSectors, Params: params.Bytes()}
+	burn := &chain.Call{MsgCid: msgCid, Index: 3, Depth: 1, Internal: true, Parent: terminate, From: minerAddr,
+		To: builtin.BurntFundsActorAddr, Value: abi.NewTokenAmount(500)}
+
+	record := NewMessageTerminationRecord(blockMeta, burn)
+	if record == nil {
+		t.Fatal("expected the fee to be recorded")
+	}
+	if record.Miner != minerAddr.String() || record.Fee != "500" || record.DeclaredSectors != 3 || record.CallIndex != 3 || record.MsgCid != msgCid.String() {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	// a burn sent directly or under another method is not a termination fee
+	if NewMessageTerminationRecord(blockMeta, &chain.Call{MsgCid: msgCid, To: builtin.BurntFundsActorAddr, Value: abi.NewTokenAmount(1)}) != nil {
+		t.Error("expected a direct send to be skipped")
+	}
+
+	other := *terminate
+	other.Method = builtin.MethodsMiner.DeclareFaultsRecovered
+	penalty := *burn
+	penalty.Parent = &other
+	if NewMessageTerminationRecord(blockMeta, &penalty) != nil {
+		t.Error("expected a burn of another method to be skipped")
+	}
+
+	// the burn is reverted with the failed call
+	failed := *terminate
+	failed.ExitCode = exitcode.ErrIllegalArgument
+	reverted := *burn
+	reverted.Parent = &failed
+	if NewMessageTerminationRecord(blockMeta, &reverted) != nil {
+		t.Error("expected a reverted burn to be skipped")
+	}
+
+	// only the fee the terminated miner pays itself
+	relayed := *burn
+	relayed.From, _ = address.NewIDAddress(1001)
+	if NewMessageTerminationRecord(blockMeta, &relayed) != nil {
+		t.Error("expected a burn sent by another actor to be skipped")
+	}
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/power"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// createMinerHandler is the name of the handler indexing the miners table
+const createMinerHandler = "create_miner"
+
+func init() {
+	Register(newCreateMinerHandler)
+}
+
+// newCreateMinerHandler returns the handler indexing the CreateMiner calls made to the power actor in
+// the miners table
+func newCreateMinerHandler() *Handler {
+	return &Handler{
+		Name: createMinerHandler,
+		Call: func(tx *Tx, blockMeta *chain.BlockMeta, call *chain.Call) error {
+			// a filter set in the config replaces the default one, other calls would fail to decode
+			if call.To != builtin.StoragePowerActorAddr || call.Method != builtin.MethodsPower.CreateMiner {
+				return nil
+			}
+
+			miner, err := NewMinerRecord(blockMeta, call)
+			if err != nil {
+				return err
+			}
+
+			// a call is identified by its message and index, indexing it again replaces the row
+			tx.Upsert(miner)
+			return nil
+		},
+		Filter: Filter{
+			To:      []address.Address{builtin.StoragePowerActorAddr},
+			Methods: []abi.MethodNum{builtin.MethodsPower.CreateMiner},
+		},
+		Models: []any{&orm.Miner{}},
+	}
+}
+
+// NewMinerRecord builds the orm.Miner row of a CreateMiner call, decoding its params and, when the
+// call succeeded, its return value
+func NewMinerRecord(blockMeta *chain.BlockMeta, call *chain.Call) (*orm.Miner, error) {
+	miner := &orm.Miner{
+		Height:    blockMeta.Height,
+		Cid:       blockMeta.Cid.String(),
+		Timestamp: blockMeta.Timestamp,
+		MsgCid:    call.MsgCid.String(),
+		CallIndex: call.Index,
+		Internal:  call.Internal,
+		From:      call.From.String(),
+		Cost:      call.Value.String(),
+		ExitCode:  int64(call.ExitCode),
+	}
+
+	// params of a failed call may be malformed, which is usually why it failed
+	var params power.CreateMinerParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(call.Params)); err != nil {
+		if call.ExitCode.IsSuccess() {
+			return nil, fmt.Errorf("decode CreateMiner params of %s: %w", call.MsgCid, err)
+		}
+
+		slog.Warn("failed to decode CreateMiner params", "msg", call.MsgCid, "exitCode", call.ExitCode, "error", err)
+		return miner, nil
+	}
+
+	miner.Owner = params.Owner.String()
+	miner.Worker = params.Worker.String()
+	miner.WindowPoStProofType = int64(params.WindowPoStProofType)
+	if sectorSize, err := params.WindowPoStProofType.SectorSize(); err == nil {
+		miner.SectorSize = uint64(sectorSize)
+	}
+
+	if peerID, err := peer.IDFromBytes(params.Peer); err == nil {
+		miner.PeerID = peerID.String()
+	}
+
+	addrs := make([]string, 0, len(params.Multiaddrs))
+	for _, raw := range params.Multiaddrs {
+		if maddr, err := multiaddr.NewMultiaddrBytes(raw); err == nil {
+			addrs = append(addrs, maddr.String())
+		}
+	}
+	miner.Multiaddrs = strings.Join(addrs, ",")
+
+	if call.ExitCode != exitcode.Ok {
+		return miner, nil
+	}
+
+	var ret power.CreateMinerReturn
+	if err := ret.UnmarshalCBOR(bytes.NewReader(call.Return)); err != nil {
+		return nil, fmt.Errorf("decode CreateMiner return of %s: %w", call.MsgCid, err)
+	}
+
+	miner.MinerID = ret.IDAddress.String()
+	miner.RobustAddress = ret.RobustAddress.String()
+
+	return miner, nil
+}
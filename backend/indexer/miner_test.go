@@ -0,0 +1,199 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/power"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/venus/venus-shared/types"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestNewMinerRecord(t *testing.T) {
+	owner, _ := address.NewIDAddress(1001)
+	worker, _ := address.NewIDAddress(1002)
+	minerID, _ := address.NewIDAddress(2000)
+	robust, _ := address.NewActorAddress([]byte("miner"))
+
+	params := power.CreateMinerParams{
+		Owner:               owner,
+		Worker:              worker,
+		WindowPoStProofType: abi.RegisteredPoStProof_StackedDrgWindow32GiBV1_1,
+		Multiaddrs:          []abi.Multiaddrs{},
+	}
+	var paramsBuf bytes.Buffer
+	if err := params.MarshalCBOR(&paramsBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	ret := power.CreateMinerReturn{IDAddress: minerID, RobustAddress: robust}
+	var retBuf bytes.Buffer
+	if err := ret.MarshalCBOR(&retBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	call := &chain.Call{
+		From:   owner,
+		To:     builtin.StoragePowerActorAddr,
+		Value:  abi.NewTokenAmount(0),
+		Method: builtin.MethodsPower.CreateMiner,
+		Params: paramsBuf.Bytes(),
+		Return: retBuf.Bytes(),
+	}
+
+	miner, err := NewMinerRecord(&chain.BlockMeta{Height: 100}, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if miner.Owner != owner.String() || miner.Worker != worker.String() {
+		t.Fatalf("unexpected owner %s or worker %s", miner.Owner, miner.Worker)
+	}
+	if miner.SectorSize != 32<<30 {
+		t.Fatalf("unexpected sector size %d", miner.SectorSize)
+	}
+	if miner.MinerID != minerID.String() || miner.RobustAddress != robust.String() {
+		t.Fatalf("unexpected miner id %s or robust address %s", miner.MinerID, miner.RobustAddress)
+	}
+
+	// a failed call has no return value and may carry params that don't decode
+	call.Params = []byte{0xff}
+	call.Return = nil
+	call.ExitCode = exitcode.ErrSerialization
+	miner, err = NewMinerRecord(&chain.BlockMeta{Height: 100}, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if miner.MinerID != "" || miner.ExitCode != int64(exitcode.ErrSerialization) {
+		t.Fatalf("unexpected record for failed message: %+v", miner)
+	}
+}
+
+// indexRows runs handler over the executed epochs of node and returns the rows of type T it wrote
+func indexRows[T any](t *testing.T, node *chain.Node, handler *Handler) []*T {
+	t.Helper()
+
+	i := NewIndexer(context.Background(), Options{}, node, nil, handler)
+	head, err := node.ChainHeadHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []*T
+	err = i.syncRange(101, head-1, i.handlers, map[string]int64{}, "", func(tx *Tx, start, end int64) error {
+		for _, q := range tx.queues {
+			rows, ok := q.rows.Interface().([]*T)
+			if !ok {
+				t.Fatalf("unexpected rows %T", q.rows.Interface())
+			}
+			out = append(out, rows...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func TestCreateMinerReplay(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	owner, _ := address.NewIDAddress(1001)
+	var msgs []*types.Message
+	for nonce, proof := range []abi.RegisteredPoStProof{abi.RegisteredPoStProof_StackedDrgWindow32GiBV1_1, abi.RegisteredPoStProof_StackedDrgWindow64GiBV1_1} {
+		params := power.CreateMinerParams{Owner: owner, Worker: owner, WindowPoStProofType: proof, Multiaddrs: []abi.Multiaddrs{}}
+		var paramsBuf bytes.Buffer
+		if err := params.MarshalCBOR(&paramsBuf); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := &types.Message{
+			From:       owner,
+			To:         builtin.StoragePowerActorAddr,
+			Nonce:      uint64(nonce),
+			Value:      abi.NewTokenAmount(0),
+			GasLimit:   1000,
+			GasFeeCap:  abi.NewTokenAmount(1),
+			GasPremium: abi.NewTokenAmount(1),
+			Method:     builtin.MethodsPower.CreateMiner,
+			Params:     paramsBuf.Bytes(),
+		}
+
+		minerID, _ := address.NewIDAddress(uint64(2000 + nonce))
+		ret := power.CreateMinerReturn{IDAddress: minerID, RobustAddress: minerID}
+		var retBuf bytes.Buffer
+		if err := ret.MarshalCBOR(&retBuf); err != nil {
+			t.Fatal(err)
+		}
+		fc.SetReceipt(msg.Cid(), &types.MessageReceipt{Return: retBuf.Bytes(), GasUsed: 1000})
+		msgs = append(msgs, msg)
+	}
+
+	// a message to another actor is filtered out
+	transfer := &types.Message{From: owner, To: owner, Nonce: 2, Value: abi.NewTokenAmount(1), GasLimit: 1000,
+		GasFeeCap: abi.NewTokenAmount(1), GasPremium: abi.NewTokenAmount(1)}
+	fc.Add(msgs[0], transfer)
+	fc.NullRounds(1)
+	fc.Add(msgs[1])
+	fc.Add()
+
+	var recording bytes.Buffer
+	recorder := chain.NewRecorder(fc, &recording)
+	want := indexRows[orm.Miner](t, chain.NewNodeFromSource(ctx, recorder), newCreateMinerHandler())
+	if err := recorder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := chain.NewReplay(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := indexRows[orm.Miner](t, chain.NewNodeFromSource(ctx, replay), newCreateMinerHandler())
+
+	if len(got) != 2 || len(want) != 2 {
+		t.Fatalf("expected 2 miners, recorded %d and replayed %d", len(want), len(got))
+	}
+
+	for idx, miner := range got {
+		if *miner != *want[idx] {
+			t.Errorf("replayed miner %d differs\nwant %+v\ngot  %+v", idx, want[idx], miner)
+		}
+	}
+
+	if got[0].Height != 101 || got[0].SectorSize != 32<<30 || got[0].MinerID != "f02000" {
+		t.Errorf("unexpected first miner %+v", got[0])
+	}
+	if got[1].Height != 103 || got[1].SectorSize != 64<<30 || got[1].MinerID != "f02001" {
+		t.Errorf("unexpected second miner %+v", got[1])
+	}
+}
+
+func TestCreateMinerIgnoresOtherCalls(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	owner, _ := address.NewIDAddress(1001)
+	transfer := &types.Message{From: owner, To: owner, Value: abi.NewTokenAmount(1), GasLimit: 1000,
+		GasFeeCap: abi.NewTokenAmount(1), GasPremium: abi.NewTokenAmount(1)}
+	fc.Add(transfer)
+	fc.Add()
+
+	// a filter from the config replaces the default one, successful calls without CreateMiner params must
+	// not halt the sync
+	handler := newCreateMinerHandler()
+	handler.Filter = Filter{}
+	if miners := indexRows[orm.Miner](t, chain.NewNodeFromSource(ctx, fc), handler); len(miners) != 0 {
+		t.Fatalf("expected no miner, got %+v", miners)
+	}
+}
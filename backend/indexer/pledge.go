@@ -0,0 +1,163 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/builtin/v16/util/smoothing"
+	"github.com/filecoin-project/venus/venus-shared/actors/adt"
+	"github.com/filecoin-project/venus/venus-shared/actors/builtin/power"
+	"github.com/filecoin-project/venus/venus-shared/actors/builtin/reward"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+const (
+	// pledgeSampleInterval is the default number of epochs between two pledge samples, one day
+	pledgeSampleInterval = 2880
+	// pledgeSectorDuration is the commitment of the sectors the pledge is sampled for, the pledge of a sector
+	// without verified deals doesn't depend on it
+	pledgeSectorDuration = 540 * builtin.EpochsInDay
+)
+
+func init() {
+	RegisterOptional(newPledgeSamplesHandler)
+}
+
+// newPledgeSamplesHandler samples the initial pledge of new sectors, the circulating supply and the reward
+// estimates, which FIP-0081 and FIP-0098 changed the use of
+func newPledgeSamplesHandler() *Handler {
+	return &Handler{
+		Name: "pledge_samples",
+		Sample: func(ctx context.Context, tx *Tx, _ *gorm.DB, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) error {
+			record, err := SamplePledge(ctx, node, tipSetMeta)
+			if err != nil {
+				return err
+			}
+
+			// a sample is identified by its height, sampling it again replaces the row
+			tx.Upsert(record)
+			return nil
+		},
+		Interval: pledgeSampleInterval,
+		Models:   []any{&orm.PledgeSample{}},
+	}
+}
+
+// SamplePledge reads the initial pledge of 32GiB and 64GiB sectors, the circulating supply and the states of
+// the reward and power actors at the tipset, the actor states are loaded with the adapters of their version
+func SamplePledge(ctx context.Context, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) (*orm.PledgeSample, error) {
+	tsk := tipSetMeta.Key
+
+	pledges := make([]abi.TokenAmount, 0, 2)
+	for _, size := range []abi.SectorSize{32 << 30, 64 << 30} {
+		pledge, err := node.StateMinerInitialPledgeForSector(ctx, pledgeSectorDuration, size, 0, tsk)
+		if err != nil {
+			return nil, fmt.Errorf("get initial pledge of %s sectors at epoch %d: %w", size.ShortString(), tipSetMeta.Height, err)
+		}
+		pledges = append(pledges, pledge)
+	}
+
+	supply, err := node.StateVMCirculatingSupplyInternal(ctx, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get circulating supply at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	store := newStateStore(ctx, node)
+
+	rewardActor, err := node.StateGetActor(ctx, builtin.RewardActorAddr, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("get reward actor at epoch %d: %w", tipSetMeta.Height, err)
+	}
+	rewardState, err := reward.Load(store, rewardActor)
+	if err != nil {
+		return nil, fmt.Errorf("load reward actor state at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	powerState, err := loadPowerState(ctx, node, store, tsk)
+	if err != nil {
+		return nil, fmt.Errorf("load power actor state at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	epochReward, err := rewardState.ThisEpochReward()
+	if err != nil {
+		return nil, err
+	}
+	rewardSmoothed, err := rewardState.ThisEpochRewardSmoothed()
+	if err != nil {
+		return nil, err
+	}
+	powerSmoothed, err := powerState.TotalPowerSmoothed()
+	if err != nil {
+		return nil, err
+	}
+
+	rewardEstimate := smoothing.FilterEstimate(rewardSmoothed)
+	dailyReward := miner.ExpectedRewardForPower(rewardEstimate, smoothing.FilterEstimate(powerSmoothed),
+		big.NewInt(32<<30), builtin.EpochsInDay)
+
+	return &orm.PledgeSample{
+		Height:              tipSetMeta.Height,
+		Timestamp:           tipSetMeta.Timestamp,
+		InitialPledge32GiB:  pledges[0].String(),
+		InitialPledge64GiB:  pledges[1].String(),
+		CirculatingSupply:   supply.FilCirculating.String(),
+		EpochReward:         epochReward.String(),
+		EpochRewardEstimate: smoothing.Estimate(&rewardEstimate).String(),
+		SectorDailyReward:   dailyReward.String(),
+	}, nil
+}
+
+// loadPowerState loads the state of the power actor at the tipset, whatever its actors version
+func loadPowerState(ctx context.Context, node chain.ChainSource, store adt.Store, tsk types.TipSetKey) (power.State, error) {
+	actor, err := node.StateGetActor(ctx, builtin.StoragePowerActorAddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	return power.Load(store, actor)
+}
+
+// stateStore reads the objects of the state through ChainReadObj, for the actor state adapters which
+// dispatch on the actors version
+type stateStore struct {
+	ctx  context.Context
+	node chain.ChainSource
+}
+
+func newStateStore(ctx context.Context, node chain.ChainSource) adt.Store {
+	return &stateStore{ctx: ctx, node: node}
+}
+
+func (s *stateStore) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stateStore) Get(ctx context.Context, c cid.Cid, out any) error {
+	unmarshaler, ok := out.(cbg.CBORUnmarshaler)
+	if !ok {
+		return fmt.Errorf("can't decode object %s into %T", c, out)
+	}
+
+	raw, err := s.node.ChainReadObj(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	return unmarshaler.UnmarshalCBOR(bytes.NewReader(raw))
+}
+
+func (s *stateStore) Put(context.Context, any) (cid.Cid, error) {
+	return cid.Undef, errors.New("the state is read-only")
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	actorstypes "github.com/filecoin-project/go-state-types/actors"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/builtin/v16/power"
+	"github.com/filecoin-project/go-state-types/builtin/v16/reward"
+	"github.com/filecoin-project/go-state-types/builtin/v16/util/smoothing"
+	"github.com/filecoin-project/go-state-types/manifest"
+	"github.com/filecoin-project/venus/venus-shared/actors"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+)
+
+// actorCode returns the code of the built-in actor key in actors version 16
+func actorCode(t *testing.T, key string) cid.Cid {
+	t.Helper()
+
+	code, ok := actors.GetActorCodeID(actorstypes.Version16, key)
+	if !ok {
+		t.Fatalf("no code for actor %s", key)
+	}
+
+	return code
+}
+
+func TestSamplePledge(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	ts := fc.Add()
+
+	fc.SetInitialPledge(32<<30, abi.NewTokenAmount(1000))
+	fc.SetInitialPledge(64<<30, abi.NewTokenAmount(2000))
+	fc.SetCirculatingSupply(types.CirculatingSupply{FilCirculating: abi.NewTokenAmount(5000)})
+
+	rewardState := reward.ConstructState(big.Zero())
+	rewardState.ThisEpochReward = abi.NewTokenAmount(42)
+	// 20 FIL per epoch for 1EiB of power, positions are Q.128 fixed point numbers
+	rewardState.ThisEpochRewardSmoothed = smoothing.NewEstimate(big.Lsh(big.Mul(big.NewInt(20), big.NewInt(1e18)), 128), big.Zero())
+	fc.SetActor(builtin.RewardActorAddr, &types.Actor{Code: actorCode(t, manifest.RewardKey), Head: fc.PutObject(rewardState)})
+
+	empty, _ := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum([]byte("empty"))
+	powerState := &power.State{
+		ThisEpochQAPowerSmoothed: smoothing.NewEstimate(big.Lsh(big.NewInt(1<<60), 128), big.Zero()),
+		CronEventQueue:           empty,
+		Claims:                   empty,
+	}
+	fc.SetActor(builtin.StoragePowerActorAddr, &types.Actor{Code: actorCode(t, manifest.PowerKey), Head: fc.PutObject(powerState)})
+
+	tipSetMeta := &chain.TipSetMeta{Height: int64(ts.Height()), Key: ts.Key(), Timestamp: int64(ts.MinTimestamp())}
+	sample, err := SamplePledge(ctx, chain.NewNodeFromSource(ctx, fc), tipSetMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sample.InitialPledge32GiB != "1000" || sample.InitialPledge64GiB != "2000" || sample.CirculatingSupply != "5000" || sample.EpochReward != "42" {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+
+	if expected := smoothing.Estimate(&rewardState.ThisEpochRewardSmoothed); sample.EpochRewardEstimate != expected.String() {
+		t.Errorf("expected a reward estimate of %s, got %s", expected, sample.EpochRewardEstimate)
+	}
+
+	expected := miner.ExpectedRewardForPower(rewardState.ThisEpochRewardSmoothed, powerState.ThisEpochQAPowerSmoothed, big.NewInt(32<<30), builtin.EpochsInDay)
+	if sample.SectorDailyReward != expected.String() || expected.IsZero() {
+		t.Errorf("expected a sector daily reward of %s, got %s", expected, sample.SectorDailyReward)
+	}
+}
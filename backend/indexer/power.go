@@ -0,0 +1,164 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/actors/builtin/power"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+const (
+	// powerSampleInterval is the default number of epochs between two power samples, one day
+	powerSampleInterval = 2880
+	// powerSampleConcurrency limits the number of miners whose power is read in parallel
+	powerSampleConcurrency = 16
+)
+
+func init() {
+	RegisterOptional(newPowerSamplesHandler)
+}
+
+// newPowerSamplesHandler samples the power of the network and of the miners indexed by the create_miner
+// handler, to tell which of the created miners went on to gain power
+func newPowerSamplesHandler() *Handler {
+	return &Handler{
+		Name: "power_samples",
+		Sample: func(ctx context.Context, tx *Tx, db *gorm.DB, node chain.ChainSource, tipSetMeta *chain.TipSetMeta) error {
+			miners, err := createdMiners(tx, db, tipSetMeta.Height)
+			if err != nil {
+				return fmt.Errorf("list created miners at epoch %d: %w", tipSetMeta.Height, err)
+			}
+
+			sample, minerPowers, err := SamplePower(ctx, node, tipSetMeta, miners)
+			if err != nil {
+				return err
+			}
+
+			// a sample is identified by its height, and the power of a miner by its height and address,
+			// sampling them again replaces the rows
+			tx.Upsert(sample)
+			for _, minerPower := range minerPowers {
+				tx.Upsert(minerPower)
+			}
+			return nil
+		},
+		Interval: powerSampleInterval,
+		Models:   []any{&orm.PowerSample{}, &orm.MinerPower{}},
+	}
+}
+
+// createdMiners returns the miners successfully created before height, whose actors exist in the state of
+// the tipset at height. They are read from the miners table and, when the create_miner handler is synced in the
+// same range, from the rows it queued in tx. The list would be incomplete while create_miner is behind, an
+// error is returned then so that the sample is taken again later.
+func createdMiners(tx *Tx, db *gorm.DB, height int64) ([]address.Address, error) {
+	var checkpoints []orm.Checkpoint
+	if err := db.Where("handler = ?", createMinerHandler).Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	if len(checkpoints) == 0 {
+		return nil, fmt.Errorf("miners are indexed by the %s handler, which never ran", createMinerHandler)
+	}
+	if checkpoint := checkpoints[0].Height; checkpoint < height-1 && !tx.Syncing(createMinerHandler) {
+		return nil, fmt.Errorf("%s handler is at epoch %d, miners are not indexed up to epoch %d yet", createMinerHandler, checkpoint, height-1)
+	}
+
+	var ids []string
+	if err := db.Model(&orm.Miner{}).
+		Where("exit_code = 0 AND miner_id <> '' AND height < ?", height).
+		Distinct().
+		Pluck("miner_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	for _, miner := range queued[orm.Miner](tx) {
+		if miner.ExitCode == 0 && miner.MinerID != "" && miner.Height < height {
+			ids = append(ids, miner.MinerID)
+		}
+	}
+
+	// rows being reindexed are both committed and queued
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	miners := make([]address.Address, 0, len(ids))
+	for _, id := range ids {
+		maddr, err := address.NewFromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid miner %s: %w", id, err)
+		}
+		miners = append(miners, maddr)
+	}
+
+	return miners, nil
+}
+
+// SamplePower reads the totals of the power actor and the power of miners at the tipset
+func SamplePower(ctx context.Context, node chain.ChainSource, tipSetMeta *chain.TipSetMeta, miners []address.Address) (*orm.PowerSample, []*orm.MinerPower, error) {
+	tsk := tipSetMeta.Key
+
+	powerState, err := loadPowerState(ctx, node, newStateStore(ctx, node), tsk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load power actor state at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	total, err := powerState.TotalPower()
+	if err != nil {
+		return nil, nil, err
+	}
+	aboveMinPower, minerCount, err := powerState.MinerCounts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sample := &orm.PowerSample{
+		Height:              tipSetMeta.Height,
+		Timestamp:           tipSetMeta.Timestamp,
+		RawBytePower:        total.RawBytePower.String(),
+		QualityAdjPower:     total.QualityAdjPower.String(),
+		MinerCount:          int64(minerCount),
+		MinersAboveMinPower: int64(aboveMinPower),
+	}
+
+	minerPowers := make([]*orm.MinerPower, len(miners))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(powerSampleConcurrency)
+	for idx, maddr := range miners {
+		g.Go(func() error {
+			mp, err := node.StateMinerPower(gctx, maddr, tsk)
+			if chain.IsActorNotFound(err) {
+				// the miner doesn't exist at the tipset, it has no power
+				mp, err = &types.MinerPower{MinerPower: power.Claim{RawBytePower: big.Zero(), QualityAdjPower: big.Zero()}}, nil
+			}
+			if err != nil {
+				return fmt.Errorf("get power of miner %s: %w", maddr, err)
+			}
+
+			minerPowers[idx] = &orm.MinerPower{
+				Height:          tipSetMeta.Height,
+				Timestamp:       tipSetMeta.Timestamp,
+				Miner:           maddr.String(),
+				RawBytePower:    mp.MinerPower.RawBytePower.String(),
+				QualityAdjPower: mp.MinerPower.QualityAdjPower.String(),
+				HasMinPower:     mp.HasMinPower,
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, nil, fmt.Errorf("sample power at epoch %d: %w", tipSetMeta.Height, err)
+	}
+
+	return sample, minerPowers, nil
+}
@@ -0,0 +1,128 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/power"
+	"github.com/filecoin-project/go-state-types/manifest"
+	minerpower "github.com/filecoin-project/venus/venus-shared/actors/builtin/power"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestSamplePower(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	ts := fc.Add()
+
+	empty, _ := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum([]byte("empty"))
+	fc.SetActor(builtin.StoragePowerActorAddr, &types.Actor{Code: actorCode(t, manifest.PowerKey), Head: fc.PutObject(&power.State{
+		TotalRawBytePower:       big.NewInt(1 << 50),
+		TotalQualityAdjPower:    big.NewInt(3 << 50),
+		MinerCount:              20,
+		MinerAboveMinPowerCount: 8,
+		CronEventQueue:          empty,
+		Claims:                  empty,
+	})})
+
+	active, _ := address.NewIDAddress(2000)
+	idle, _ := address.NewIDAddress(2001)
+	fc.SetMinerPower(active, &types.MinerPower{
+		MinerPower:  minerpower.Claim{RawBytePower: big.NewInt(10 << 40), QualityAdjPower: big.NewInt(100 << 40)},
+		HasMinPower: true,
+	})
+	fc.SetMinerPower(idle, &types.MinerPower{
+		MinerPower: minerpower.Claim{RawBytePower: big.Zero(), QualityAdjPower: big.Zero()},
+	})
+
+	tipSetMeta := &chain.TipSetMeta{Height: int64(ts.Height()), Key: ts.Key(), Timestamp: int64(ts.MinTimestamp())}
+	sample, minerPowers, err := SamplePower(ctx, chain.NewNodeFromSource(ctx, fc), tipSetMeta, []address.Address{active, idle})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sample.Height != 101 || sample.RawBytePower != big.NewInt(1<<50).String() || sample.QualityAdjPower != big.NewInt(3<<50).String() ||
+		sample.MinerCount != 20 || sample.MinersAboveMinPower != 8 {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+
+	if len(minerPowers) != 2 {
+		t.Fatalf("expected the power of both miners, got %d", len(minerPowers))
+	}
+
+	if mp := minerPowers[0]; mp.Miner != active.String() || mp.QualityAdjPower != big.NewInt(100<<40).String() || !mp.HasMinPower || mp.Height != 101 {
+		t.Errorf("unexpected power %+v", mp)
+	}
+
+	if mp := minerPowers[1]; mp.Miner != idle.String() || mp.RawBytePower != "0" || mp.HasMinPower {
+		t.Errorf("unexpected power %+v", mp)
+	}
+
+	// a miner without actor at the tipset has no power
+	unknown, _ := address.NewIDAddress(2002)
+	_, minerPowers, err = SamplePower(ctx, chain.NewNodeFromSource(ctx, fc), tipSetMeta, []address.Address{unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp := minerPowers[0]; mp.Miner != unknown.String() || mp.RawBytePower != "0" || mp.QualityAdjPower != "0" || mp.HasMinPower {
+		t.Errorf("unexpected power %+v", mp)
+	}
+}
+
+func TestCreatedMiners(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := createdMiners(NewTx(), db, 200); err == nil {
+		t.Error("expected miners to be refused without the create_miner handler")
+	}
+
+	for idx, miner := range []orm.Miner{
+		{Height: 150, MinerID: "f02000"},
+		{Height: 199, MinerID: "f02001"},
+		// created in the sampled tipset, its actor only exists in the state of the next one
+		{Height: 200, MinerID: "f02002"},
+		{Height: 150, ExitCode: 16},
+	} {
+		miner.MsgCid = fmt.Sprintf("msg%d", idx)
+		if err := db.Create(&miner).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Create(&orm.Checkpoint{Handler: createMinerHandler, Height: 150}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createdMiners(NewTx(), db, 200); err == nil {
+		t.Error("expected miners to be refused while create_miner is behind")
+	}
+
+	// create_miner synced in the same range queued the miners above its checkpoint
+	tx := NewTx()
+	tx.syncing = []string{createMinerHandler, "power_samples"}
+	tx.Upsert(&orm.Miner{Height: 199, MinerID: "f02001"}, &orm.Miner{Height: 180, MinerID: "f02003"})
+
+	miners, err := createdMiners(tx, db, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(miners); got != "[f02000 f02001 f02003]" {
+		t.Errorf("unexpected miners %s", got)
+	}
+
+	if err := db.Model(&orm.Checkpoint{}).Where("handler = ?", createMinerHandler).Update("height", 199).Error; err != nil {
+		t.Fatal(err)
+	}
+	if miners, err := createdMiners(NewTx(), db, 200); err != nil || fmt.Sprint(miners) != "[f02000 f02001]" {
+		t.Errorf("unexpected miners %v, %v", miners, err)
+	}
+}
@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// registry holds the constructors of the handlers available to NewHandlers by name
+var registry = map[string]func() *Handler{}
+
+// optional holds the names of the handlers only built when they are configured
+var optional = map[string]bool{}
+
+// Register makes the handler built by newHandler available to NewHandlers under its name, it is meant to
+// be called from init. newHandler must set the default filter of the handler.
+func Register(newHandler func() *Handler) {
+	name := newHandler().Name
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("handler %s registered twice", name))
+	}
+
+	registry[name] = newHandler
+}
+
+// RegisterOptional registers a handler like Register, but NewHandlers only builds it when it is configured.
+// It is meant for the handlers that need more than plain syncing from the node, such as actor events,
+// tracing or historical state.
+func RegisterOptional(newHandler func() *Handler) {
+	Register(newHandler)
+	optional[newHandler().Name] = true
+}
+
+// RegisteredHandlers returns the names of the registered handlers, sorted
+func RegisteredHandlers() []string {
+	return slices.Sorted(maps.Keys(registry))
+}
+
+// DefaultHandlers returns the names of the registered handlers built when none is configured, sorted
+func DefaultHandlers() []string {
+	return slices.DeleteFunc(RegisteredHandlers(), func(name string) bool { return optional[name] })
+}
+
+// HandlerConfig enables a registered handler in the YAML configuration
+type HandlerConfig struct {
+	Name string `yaml:"name"`
+	// Filter replaces the fields it sets in the default filter of the handler
+	Filter *FilterConfig `yaml:"filter"`
+	// Interval replaces the default number of epochs between two samples of a sampling handler
+	Interval int64 `yaml:"interval"`
+}
+
+// NewHandlers builds the handlers listed in configs, in their order. The default handlers are built with
+// their default filter when configs is empty.
+func NewHandlers(configs []HandlerConfig) ([]*Handler, error) {
+	if len(configs) == 0 {
+		for _, name := range DefaultHandlers() {
+			configs = append(configs, HandlerConfig{Name: name})
+		}
+	}
+
+	handlers := make([]*Handler, 0, len(configs))
+	for _, config := range configs {
+		newHandler, ok := registry[config.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown handler %s, registered handlers are %v", config.Name, RegisteredHandlers())
+		}
+
+		if slices.ContainsFunc(handlers, func(h *Handler) bool { return h.Name == config.Name }) {
+			return nil, fmt.Errorf("handler %s configured twice", config.Name)
+		}
+
+		handler := newHandler()
+
+		var err error
+		if handler.Filter, err = config.Filter.apply(handler.Filter); err != nil {
+			return nil, fmt.Errorf("handler %s: %w", config.Name, err)
+		}
+
+		if config.Interval != 0 {
+			if handler.Sample == nil {
+				return nil, fmt.Errorf("handler %s: interval set on a handler that doesn't sample", config.Name)
+			}
+			if config.Interval < 0 {
+				return nil, fmt.Errorf("handler %s: negative interval %d", config.Name, config.Interval)
+			}
+			handler.Interval = config.Interval
+		}
+
+		handlers = append(handlers, handler)
+	}
+
+	return handlers, nil
+}
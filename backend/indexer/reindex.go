@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// Reindex deletes the rows written by the named handlers, or all registered handlers when names is empty,
+// between from and to and syncs the range again. Each range of rangeEpochNum epochs is replaced in a single
+// transaction and recorded as synced, checkpoints are left untouched, so it is safe to run while the indexer follows the tip.
+// A zero to reindexes up to the latest executed tipset. A handler sharing a table with a registered handler
+// which is not reindexed is refused. With Options.DryRun the rows are discarded and
+// nothing is written.
+func (i *Indexer) Reindex(from, to int64, names ...string) error {
+	head, err := i.node.ChainHead(i.ctx)
+	if err != nil {
+		return err
+	}
+
+	// messages of the head are not executed yet
+	if to == 0 || to >= int64(head.Height()) {
+		to = int64(head.Height()) - 1
+	}
+
+	if from > to {
+		return errors.New("from must be less than or equal to to")
+	}
+
+	handlers := i.handlers
+	if len(names) > 0 {
+		handlers = nil
+		for _, name := range names {
+			handler, err := i.handler(name)
+			if err != nil {
+				return err
+			}
+
+			handlers = append(handlers, handler)
+		}
+	}
+
+	if len(handlers) == 0 {
+		return errors.New("no handler to reindex")
+	}
+
+	if err := i.checkHandlers(handlers); err != nil {
+		return err
+	}
+
+	// the rows of the range are deleted before they are written again, which would drop the rows of a co-writer
+	for _, handler := range handlers {
+		for _, model := range handler.Models {
+			if owner := i.sharedModel(model, handlers...); owner != "" {
+				return fmt.Errorf("handler %s shares the table of %T with handler %s, reindex them together", handler.Name, model, owner)
+			}
+		}
+	}
+
+	slog.Info("reindexing", slog.Any("handlers", handlerNames(handlers)), slog.Int64("from", from), slog.Int64("to", to))
+
+	// every epoch of the range is handled again, whatever the checkpoints are
+	return i.syncRange(from, to, handlers, map[string]int64{}, "", func(tx *Tx, start, end int64) error {
+		if i.opts.DryRun {
+			slog.Debug("discarding reindexed rows", slog.Int64("start", start), slog.Int64("end", end), slog.Int("rows", tx.Len()))
+			return nil
+		}
+
+		return i.db.Transaction(func(db *gorm.DB) error {
+			for _, handler := range handlers {
+				for _, model := range handler.Models {
+					if err := db.Unscoped().Where("height BETWEEN ? AND ?", start, end).Delete(model).Error; err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := tx.Flush(db); err != nil {
+				return err
+			}
+
+			for _, handler := range handlers {
+				if err := recordRange(db, handler.Name, start, end); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// handler returns the registered handler called name
+func (i *Indexer) handler(name string) (*Handler, error) {
+	for _, handler := range i.handlers {
+		if handler.Name == name {
+			return handler, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown handler %s", name)
+}
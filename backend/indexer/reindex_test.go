@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestReindexDryRun(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+	fc.Add()
+	node := chain.NewNodeFromSource(ctx, fc)
+
+	if err := db.Create(&orm.ChainStat{Height: 101, ParentWeight: "indexed"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewIndexer(ctx, Options{DryRun: true}, node, db, newChainStatsHandler())
+	if err := i.Reindex(101, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []orm.ChainStat
+	db.Find(&stats)
+	if len(stats) != 1 || stats[0].ParentWeight != "indexed" {
+		t.Fatalf("expected the indexed rows to be kept, got %+v", stats)
+	}
+
+	var ranges int64
+	db.Model(&orm.SyncedRange{}).Count(&ranges)
+	if ranges != 0 {
+		t.Fatalf("expected no synced range, got %d", ranges)
+	}
+
+	i = NewIndexer(ctx, Options{}, node, db, newChainStatsHandler())
+	if err := i.Reindex(101, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Find(&stats)
+	if len(stats) != 2 || stats[0].ParentWeight == "indexed" {
+		t.Fatalf("expected the range to be replaced, got %+v", stats)
+	}
+}
+
+func TestReindexNeedsTrace(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+
+	// without tracing the termination fees are never seen, the range would be recorded as synced without them
+	i := NewIndexer(ctx, Options{DryRun: true}, chain.NewNodeFromSource(ctx, fc), nil, newMessageTerminationsHandler())
+	if err := i.Reindex(101, 0); err == nil {
+		t.Fatal("expected a handler of traced calls to be refused without tracing")
+	}
+
+	i = NewIndexer(ctx, Options{DryRun: true, Trace: true}, chain.NewNodeFromSource(ctx, fc), nil, newMessageTerminationsHandler())
+	if err := i.Reindex(101, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReindexSharedModel(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+	fc.Add()
+	fc.Add()
+
+	// deleting the range of the table would drop the rows of the handler which isn't reindexed
+	owner := &Handler{Name: "owner", Models: []any{&orm.Miner{}}}
+	shared := &Handler{Name: "shared", Models: []any{&orm.Miner{}}}
+	i := NewIndexer(ctx, Options{DryRun: true}, chain.NewNodeFromSource(ctx, fc), nil, owner, shared)
+	if err := i.Reindex(101, 0, owner.Name); err == nil {
+		t.Fatal("expected a handler sharing a table with a handler which isn't reindexed to be refused")
+	}
+
+	if err := i.Reindex(101, 0, owner.Name, shared.Name); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+// sectorMethod is a miner actor method indexed by the sector_messages handler
+type sectorMethod struct {
+	name string
+	// count decodes the params of the method and returns the number of sectors they cover
+	count func(params []byte) (int64, error)
+}
+
+var sectorMethods = map[abi.MethodNum]sectorMethod{
+	builtin.MethodsMiner.PreCommitSectorBatch2: {name: "PreCommitSectorBatch2", count: func(params []byte) (int64, error) {
+		var p miner.PreCommitSectorBatchParams2
+		err := decodeParams(params, &p)
+		return int64(len(p.Sectors)), err
+	}},
+	builtin.MethodsMiner.ProveCommitAggregate: {name: "ProveCommitAggregate", count: func(params []byte) (int64, error) {
+		var p miner.ProveCommitAggregateParams
+		if err := decodeParams(params, &p); err != nil {
+			return 0, err
+		}
+
+		n, err := p.SectorNumbers.Count()
+		return int64(n), err
+	}},
+	builtin.MethodsMiner.ProveCommitSectors3: {name: "ProveCommitSectors3", count: func(params []byte) (int64, error) {
+		var p miner.ProveCommitSectors3Params
+		err := decodeParams(params, &p)
+		return int64(len(p.SectorActivations)), err
+	}},
+	builtin.MethodsMiner.ProveReplicaUpdates3: {name: "ProveReplicaUpdates3", count: func(params []byte) (int64, error) {
+		var p miner.ProveReplicaUpdates3Params
+		err := decodeParams(params, &p)
+		return int64(len(p.SectorUpdates)), err
+	}},
+	builtin.MethodsMiner.ExtendSectorExpiration: {name: "ExtendSectorExpiration", count: func(params []byte) (int64, error) {
+		var p miner.ExtendSectorExpirationParams
+		if err := decodeParams(params, &p); err != nil {
+			return 0, err
+		}
+
+		var total int64
+		for _, ext := range p.Extensions {
+			n, err := ext.Sectors.Count()
+			if err != nil {
+				return 0, err
+			}
+			total += int64(n)
+		}
+		return total, nil
+	}},
+	builtin.MethodsMiner.ExtendSectorExpiration2: {name: "ExtendSectorExpiration2", count: func(params []byte) (int64, error) {
+		var p miner.ExtendSectorExpiration2Params
+		if err := decodeParams(params, &p); err != nil {
+			return 0, err
+		}
+
+		var total int64
+		for _, ext := range p.Extensions {
+			n, err := ext.Sectors.Count()
+			if err != nil {
+				return 0, err
+			}
+			total += int64(n) + int64(len(ext.SectorsWithClaims))
+		}
+		return total, nil
+	}},
+}
+
+func decodeParams(params []byte, v cbg.CBORUnmarshaler) error {
+	return v.UnmarshalCBOR(bytes.NewReader(params))
+}
+
+func init() {
+	Register(newSectorMessagesHandler)
+}
+
+// newSectorMessagesHandler returns the handler indexing the messages sent to miner actors to onboard and
+// maintain sectors in the sector_messages table. Only messages are indexed, not calls made by other actors,
+// as the gas used is only known for messages.
+func newSectorMessagesHandler() *Handler {
+	methods := make([]abi.MethodNum, 0, len(sectorMethods))
+	for method := range sectorMethods {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+
+	return &Handler{
+		Name: "sector_messages",
+		Msg: func(tx *Tx, blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) error {
+			record, err := NewSectorMessageRecord(blockMeta, msg, receipt)
+			if err != nil {
+				return err
+			}
+
+			// a message is identified by its cid, indexing it again replaces the row
+			tx.Upsert(record)
+			return nil
+		},
+		Filter: Filter{
+			Actors:  []string{"storageminer"},
+			Methods: methods,
+		},
+		Models: []any{&orm.SectorMessage{}},
+	}
+}
+
+// NewSectorMessageRecord creates a row from a message sent to a miner actor with one of the sector methods
+func NewSectorMessageRecord(blockMeta *chain.BlockMeta, msg *types.Message, receipt *types.MessageReceipt) (*orm.SectorMessage, error) {
+	method, ok := sectorMethods[msg.Method]
+	if !ok {
+		return nil, fmt.Errorf("method %d of %s is not a sector method", msg.Method, msg.Cid())
+	}
+
+	record := &orm.SectorMessage{
+		Height:     blockMeta.Height,
+		Cid:        blockMeta.Cid.String(),
+		Timestamp:  blockMeta.Timestamp,
+		MsgCid:     msg.Cid().String(),
+		Miner:      msg.To.String(),
+		From:       msg.From.String(),
+		Method:     int64(msg.Method),
+		MethodName: method.name,
+		GasUsed:    receipt.GasUsed,
+		ExitCode:   int64(receipt.ExitCode),
+	}
+
+	// params of a failed message may be malformed, which is usually why it failed
+	count, err := method.count(msg.Params)
+	if err != nil {
+		if receipt.ExitCode.IsSuccess() {
+			return nil, fmt.Errorf("decode %s params of %s: %w", method.name, msg.Cid(), err)
+		}
+
+		slog.Warn("failed to decode sector params", "msg", msg.Cid(), "method", method.name, "exitCode", receipt.ExitCode, "error", err)
+		return record, nil
+	}
+
+	record.SectorCount = count
+	return record, nil
+}
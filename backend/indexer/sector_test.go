@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v16/miner"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/go-state-types/manifest"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/ipfs-force-community/janus/chain"
+	"github.com/ipfs-force-community/janus/chain/chaintest"
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestNewSectorMessageRecord(t *testing.T) {
+	minerAddr, _ := address.NewIDAddress(1000)
+	worker, _ := address.NewIDAddress(1001)
+	sealed, _ := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte("sealed"))
+
+	encode := func(params cbg.CBORMarshaler) []byte {
+		var buf bytes.Buffer
+		if err := params.MarshalCBOR(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name   string
+		method abi.MethodNum
+		params []byte
+		want   int64
+	}{
+		{name: "PreCommitSectorBatch2", method: builtin.MethodsMiner.PreCommitSectorBatch2, want: 2, params: encode(&miner.PreCommitSectorBatchParams2{
+			Sectors: []miner.SectorPreCommitInfo{{SectorNumber: 1, SealedCID: sealed}, {SectorNumber: 2, SealedCID: sealed}},
+		})},
+		{name: "ProveCommitAggregate", method: builtin.MethodsMiner.ProveCommitAggregate, want: 3, params: encode(&miner.ProveCommitAggregateParams{
+			SectorNumbers: bitfield.NewFromSet([]uint64{1, 2, 5}),
+		})},
+		{name: "ProveCommitSectors3", method: builtin.MethodsMiner.ProveCommitSectors3, want: 1, params: encode(&miner.ProveCommitSectors3Params{
+			SectorActivations: []miner.SectorActivationManifest{{SectorNumber: 1}},
+		})},
+		{name: "ProveReplicaUpdates3", method: builtin.MethodsMiner.ProveReplicaUpdates3, want: 2, params: encode(&miner.ProveReplicaUpdates3Params{
+			SectorUpdates: []miner.SectorUpdateManifest{{Sector: 1, NewSealedCID: sealed}, {Sector: 2, NewSealedCID: sealed}},
+		})},
+		{name: "ExtendSectorExpiration", method: builtin.MethodsMiner.ExtendSectorExpiration, want: 4, params: encode(&miner.ExtendSectorExpirationParams{
+			Extensions: []miner.ExpirationExtension{{Sectors: bitfield.NewFromSet([]uint64{1, 2})}, {Sectors: bitfield.NewFromSet([]uint64{7, 9})}},
+		})},
+		{name: "ExtendSectorExpiration2", method: builtin.MethodsMiner.ExtendSectorExpiration2, want: 3, params: encode(&miner.ExtendSectorExpiration2Params{
+			Extensions: []miner.ExpirationExtension2{{Sectors: bitfield.NewFromSet([]uint64{1, 2}), SectorsWithClaims: []miner.SectorClaim{{SectorNumber: 3}}}},
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &types.Message{From: worker, To: minerAddr, Method: tt.method, Params: tt.params}
+			record, err := NewSectorMessageRecord(&chain.BlockMeta{Height: 100}, msg, &types.MessageReceipt{GasUsed: 42})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if record.SectorCount != tt.want || record.MethodName != tt.name || record.Miner != minerAddr.String() || record.GasUsed != 42 {
+				t.Errorf("unexpected record %+v", record)
+			}
+		})
+	}
+
+	// params of a failed message may not decode
+	msg := &types.Message{From: worker, To: minerAddr, Method: builtin.MethodsMiner.ProveCommitSectors3, Params: []byte{0xff}}
+	record, err := NewSectorMessageRecord(&chain.BlockMeta{Height: 100}, msg, &types.MessageReceipt{ExitCode: exitcode.ErrSerialization})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.SectorCount != 0 || record.ExitCode != int64(exitcode.ErrSerialization) {
+		t.Errorf("unexpected record for failed message %+v", record)
+	}
+
+	if _, err := NewSectorMessageRecord(&chain.BlockMeta{Height: 100}, msg, &types.MessageReceipt{}); err == nil {
+		t.Error("expected an error for a successful message with malformed params")
+	}
+}
+
+// unavailableState is a chain whose state can't be read, like a snapshot
+type unavailableState struct {
+	*chaintest.Chain
+}
+
+func (unavailableState) StateGetActor(context.Context, address.Address, types.TipSetKey) (*types.Actor, error) {
+	return nil, errors.New("state not available")
+}
+
+func TestSectorMessagesActorLookupFails(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	minerAddr, _ := address.NewIDAddress(1000)
+	worker, _ := address.NewIDAddress(1001)
+	fc.Add(&types.Message{From: worker, To: minerAddr, Value: abi.NewTokenAmount(0), GasLimit: 1000,
+		GasFeeCap: abi.NewTokenAmount(1), GasPremium: abi.NewTokenAmount(1), Method: builtin.MethodsMiner.PreCommitSectorBatch2})
+	fc.Add()
+
+	// the range fails instead of being recorded without the message
+	i := NewIndexer(ctx, Options{}, chain.NewNodeFromSource(ctx, unavailableState{fc}), nil, newSectorMessagesHandler())
+	err := i.syncRange(101, 101, i.handlers, map[string]int64{}, "", func(tx *Tx, start, end int64) error {
+		t.Fatal("range committed without the actor of the message")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the failed lookup to fail the range")
+	}
+}
+
+// reassignedActor is a chain where the actor at addr is a miner at the tipset miner and an account at any other
+type reassignedActor struct {
+	*chaintest.Chain
+	addr        address.Address
+	miner       types.TipSetKey
+	minerCode   cid.Cid
+	accountCode cid.Cid
+}
+
+func (r reassignedActor) StateGetActor(ctx context.Context, addr address.Address, tsk types.TipSetKey) (*types.Actor, error) {
+	if addr != r.addr {
+		return r.Chain.StateGetActor(ctx, addr, tsk)
+	}
+
+	if tsk == r.miner {
+		return &types.Actor{Code: r.minerCode}, nil
+	}
+	return &types.Actor{Code: r.accountCode}, nil
+}
+
+func TestSectorMessagesActorAtTipSet(t *testing.T) {
+	ctx := context.Background()
+	fc := chaintest.NewChain(100)
+
+	minerAddr, _ := address.NewIDAddress(1000)
+	worker, _ := address.NewIDAddress(1001)
+	newMessage := func(nonce uint64) *types.Message {
+		msg := &types.Message{From: worker, To: minerAddr, Nonce: nonce, Value: abi.NewTokenAmount(0), GasLimit: 1000,
+			GasFeeCap: abi.NewTokenAmount(1), GasPremium: abi.NewTokenAmount(1), Method: builtin.MethodsMiner.PreCommitSectorBatch2}
+		fc.SetReceipt(msg.Cid(), &types.MessageReceipt{ExitCode: exitcode.ErrSerialization})
+		return msg
+	}
+
+	first := newMessage(0)
+	ts := fc.Add(first)
+	fc.Add(newMessage(1))
+	fc.Add()
+
+	// the actor is only a miner at the first tipset, the name resolved for it is not reused for the second one
+	node := chain.NewNodeFromSource(ctx, reassignedActor{
+		Chain:       fc,
+		addr:        minerAddr,
+		miner:       ts.Key(),
+		minerCode:   actorCode(t, manifest.MinerKey),
+		accountCode: actorCode(t, manifest.AccountKey),
+	})
+	rows := indexRows[orm.SectorMessage](t, node, newSectorMessagesHandler())
+	if len(rows) != 1 || rows[0].MsgCid != first.Cid().String() {
+		t.Fatalf("expected only the message sent while the actor was a miner, got %+v", rows)
+	}
+}
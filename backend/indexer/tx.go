@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tx is the handle handlers write through. Rows are buffered while a range of epochs is synced, then
+// inserted in bulk in the database transaction that also moves the checkpoints of the range, so that a
+// range is either fully applied or not at all.
+type Tx struct {
+	queues []*rowQueue
+	index  map[queueKey]*rowQueue
+	// syncing holds the names of the handlers synced in the range
+	syncing []string
+}
+
+type queueKey struct {
+	typ    reflect.Type
+	upsert bool
+}
+
+// rowQueue holds the buffered rows of one model, rows is a slice of pointers to the model
+type rowQueue struct {
+	upsert bool
+	rows   reflect.Value
+}
+
+// NewTx returns an empty Tx
+func NewTx() *Tx {
+	return &Tx{index: make(map[queueKey]*rowQueue)}
+}
+
+// Create queues rows to be inserted when the range is committed, rows must be pointers to models
+func (tx *Tx) Create(rows ...any) {
+	tx.queue(false, rows)
+}
+
+// Upsert queues rows to be inserted when the range is committed, replacing the existing rows with the
+// same unique key
+func (tx *Tx) Upsert(rows ...any) {
+	tx.queue(true, rows)
+}
+
+func (tx *Tx) queue(upsert bool, rows []any) {
+	for _, row := range rows {
+		value := reflect.ValueOf(row)
+		key := queueKey{typ: value.Type(), upsert: upsert}
+
+		q, ok := tx.index[key]
+		if !ok {
+			q = &rowQueue{upsert: upsert, rows: reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1)}
+			tx.index[key] = q
+			tx.queues = append(tx.queues, q)
+		}
+
+		q.rows = reflect.Append(q.rows, value)
+	}
+}
+
+// Syncing reports whether the handler name is synced in the same range, the rows it wrote for the epochs
+// delivered so far are then queued in tx rather than committed
+func (tx *Tx) Syncing(name string) bool {
+	return slices.Contains(tx.syncing, name)
+}
+
+// queued returns the rows of type T queued in tx
+func queued[T any](tx *Tx) []*T {
+	var out []*T
+	for _, q := range tx.queues {
+		if rows, ok := q.rows.Interface().([]*T); ok {
+			out = append(out, rows...)
+		}
+	}
+
+	return out
+}
+
+// Len returns the number of queued rows
+func (tx *Tx) Len() int {
+	var n int
+	for _, q := range tx.queues {
+		n += q.rows.Len()
+	}
+
+	return n
+}
+
+// Flush inserts the queued rows in db in the order their models were first queued, batched by the
+// CreateBatchSize of db, and empties the Tx
+func (tx *Tx) Flush(db *gorm.DB) error {
+	for _, q := range tx.queues {
+		stmt := db
+		if q.upsert {
+			stmt = db.Clauses(clause.OnConflict{UpdateAll: true})
+		}
+
+		if err := stmt.Create(q.rows.Interface()).Error; err != nil {
+			return err
+		}
+	}
+
+	tx.queues = nil
+	clear(tx.index)
+	return nil
+}
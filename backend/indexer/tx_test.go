@@ -0,0 +1,44 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/ipfs-force-community/janus/database/orm"
+)
+
+func TestTxQueue(t *testing.T) {
+	tx := NewTx()
+	tx.Create(&orm.Miner{Height: 1}, &orm.Miner{Height: 2})
+	tx.Upsert(&orm.TipSet{Height: 1})
+	tx.Create(&orm.Miner{Height: 3})
+	tx.Upsert(&orm.Miner{Height: 4})
+
+	if tx.Len() != 5 {
+		t.Fatalf("expected 5 queued rows, got %d", tx.Len())
+	}
+
+	// rows of a model are grouped in one slice so that they are inserted in bulk, in the order the
+	// models were first queued
+	if len(tx.queues) != 3 {
+		t.Fatalf("expected 3 queues, got %d", len(tx.queues))
+	}
+
+	miners, ok := tx.queues[0].rows.Interface().([]*orm.Miner)
+	if !ok || tx.queues[0].upsert {
+		t.Fatalf("expected first queue to insert miners, got %T", tx.queues[0].rows.Interface())
+	}
+
+	for idx, height := range []int64{1, 2, 3} {
+		if miners[idx].Height != height {
+			t.Errorf("expected miner %d at height %d, got %d", idx, height, miners[idx].Height)
+		}
+	}
+
+	if _, ok := tx.queues[1].rows.Interface().([]*orm.TipSet); !ok || !tx.queues[1].upsert {
+		t.Errorf("expected second queue to upsert tipsets")
+	}
+
+	if !tx.queues[2].upsert || tx.queues[2].rows.Len() != 1 {
+		t.Errorf("expected third queue to upsert one miner")
+	}
+}